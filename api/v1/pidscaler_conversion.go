@@ -0,0 +1,249 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v2 "github.com/timson/pidhpa-operator/api/v2"
+)
+
+// ConversionDataAnnotation keeps the v1 fields without a v2 counterpart, so v1 objects survive a round trip through v2
+const ConversionDataAnnotation = "pidscaler.ts/v1-conversion-data"
+
+// conversionData holds the deprecated v1 fields dropped from v2, credentials are kept as deprecated v2 fields
+// instead so they never show up in the annotations
+type conversionData struct {
+	Deployment string `json:"deployment,omitempty"`
+	// The v1 spec had no scaleTargetRef and the v2 one was derived from Deployment
+	DerivedScaleTargetRef bool `json:"derivedScaleTargetRef,omitempty"`
+}
+
+var _ conversion.Convertible = &PIDScaler{}
+
+// ConvertTo converts this PIDScaler to the hub version (v2)
+func (src *PIDScaler) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v2.PIDScaler)
+	if !ok {
+		return fmt.Errorf("expected a v2 PIDScaler but got a %T", dstRaw)
+	}
+	in := src.DeepCopy()
+	var data conversionData
+
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = v2.PIDScalerSpec{
+		Source: v2.SourceSettings{
+			Type:       in.Spec.Source.Type,
+			Prometheus: (*v2.PrometheusSettings)(in.Spec.Source.Prometheus),
+		},
+		PID: v2.PIDSettings{
+			Mode:                 in.Spec.PID.Mode,
+			Kp:                   v2.Gain(in.Spec.PID.Kp),
+			Ki:                   v2.Gain(in.Spec.PID.Ki),
+			Kd:                   v2.Gain(in.Spec.PID.Kd),
+			ReferenceSignal:      in.Spec.PID.ReferenceSignal,
+			DerivativeOn:         in.Spec.PID.DerivativeOn,
+			DerivativeFilterTime: v2.Decimal(in.Spec.PID.DerivativeFilterTime),
+			DerivativeFilterN:    v2.Decimal(in.Spec.PID.DerivativeFilterN),
+			AntiWindup:           in.Spec.PID.AntiWindup,
+			TrackingGain:         v2.Decimal(in.Spec.PID.TrackingGain),
+			IntegralMin:          v2.SignedDecimal(in.Spec.PID.IntegralMin),
+			IntegralMax:          v2.SignedDecimal(in.Spec.PID.IntegralMax),
+			SetpointWeightP:      v2.Decimal(in.Spec.PID.SetpointWeightP),
+			SetpointWeightD:      v2.Decimal(in.Spec.PID.SetpointWeightD),
+			SetpointRampRate:     v2.Decimal(in.Spec.PID.SetpointRampRate),
+			Deadband:             in.Spec.PID.Deadband,
+		},
+		Target: v2.TargetSettings{
+			Namespace:   in.Spec.Target.Namespace,
+			MinReplicas: in.Spec.Target.MinReplicas,
+			MaxReplicas: in.Spec.Target.MaxReplicas,
+			Behavior:    in.Spec.Target.Behavior,
+		},
+		Interval:        in.Spec.Interval,
+		CooldownTimeout: in.Spec.CooldownTimeout,
+	}
+	data.Deployment = in.Spec.Target.Deployment
+	if in.Spec.Target.ScaleTargetRef != nil {
+		dst.Spec.Target.ScaleTargetRef = *in.Spec.Target.ScaleTargetRef
+	} else {
+		dst.Spec.Target.ScaleTargetRef = in.Spec.Target.GetScaleTargetRef()
+		data.DerivedScaleTargetRef = true
+	}
+	if kafka := in.Spec.Kafka; kafka != nil {
+		dst.Spec.Kafka = &v2.KafkaSettings{
+			Brokers:              kafka.Brokers,
+			Topic:                kafka.Topic,
+			Topics:               kafka.Topics,
+			TopicPattern:         kafka.TopicPattern,
+			Aggregation:          kafka.Aggregation,
+			LagMode:              kafka.LagMode,
+			Group:                kafka.Group,
+			UseSASL:              kafka.UseSASL,
+			SASLMechanism:        kafka.SASLMechanism,
+			Username:             kafka.Username,
+			Password:             kafka.Password,
+			CredentialsSecretRef: (*v2.CredentialsSecretRef)(kafka.CredentialsSecretRef),
+			OAuth:                (*v2.KafkaOAuthSettings)(kafka.OAuth),
+			CapToPartitions:      kafka.CapToPartitions,
+			PartitionLagMetrics:  kafka.PartitionLagMetrics,
+			GroupStatePolicy:     (*v2.GroupStatePolicy)(kafka.GroupStatePolicy),
+		}
+		if tls := kafka.TLS; tls != nil {
+			dst.Spec.Kafka.TLS = &v2.KafkaTLSSettings{
+				Enable:             tls.Enable,
+				CASecretRef:        (*v2.SecretKeyRef)(tls.CASecretRef),
+				CertSecretRef:      (*v2.SecretKeyRef)(tls.CertSecretRef),
+				KeySecretRef:       (*v2.SecretKeyRef)(tls.KeySecretRef),
+				InsecureSkipVerify: tls.InsecureSkipVerify,
+				ServerName:         tls.ServerName,
+			}
+		}
+	}
+	dst.Status = v2.PIDScalerStatus{
+		Status:             in.Status.Status,
+		Message:            in.Status.Message,
+		UpdateTime:         in.Status.UpdateTime,
+		GroupState:         in.Status.GroupState,
+		ObservedGeneration: in.Status.ObservedGeneration,
+		LastMeasuredValue:  in.Status.LastMeasuredValue,
+		LastOutput:         in.Status.LastOutput,
+		CurrentReplicas:    in.Status.CurrentReplicas,
+		DesiredReplicas:    in.Status.DesiredReplicas,
+		LastScaleTime:      in.Status.LastScaleTime,
+		PIDState:           (*v2.PIDStateSnapshot)(in.Status.PIDState),
+		Conditions:         in.Status.Conditions,
+	}
+
+	delete(dst.Annotations, ConversionDataAnnotation)
+	if data != (conversionData{}) {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[ConversionDataAnnotation] = string(raw)
+	}
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v2) to this version
+func (dst *PIDScaler) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v2.PIDScaler)
+	if !ok {
+		return fmt.Errorf("expected a v2 PIDScaler but got a %T", srcRaw)
+	}
+	in := src.DeepCopy()
+	var data conversionData
+	if raw, ok := in.Annotations[ConversionDataAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", ConversionDataAnnotation, err)
+		}
+		delete(in.Annotations, ConversionDataAnnotation)
+	}
+
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = PIDScalerSpec{
+		Source: SourceSettings{
+			Type:       in.Spec.Source.Type,
+			Prometheus: (*PrometheusSettings)(in.Spec.Source.Prometheus),
+		},
+		PID: PIDSettings{
+			Mode:                 in.Spec.PID.Mode,
+			Kp:                   string(in.Spec.PID.Kp),
+			Ki:                   string(in.Spec.PID.Ki),
+			Kd:                   string(in.Spec.PID.Kd),
+			ReferenceSignal:      in.Spec.PID.ReferenceSignal,
+			DerivativeOn:         in.Spec.PID.DerivativeOn,
+			DerivativeFilterTime: string(in.Spec.PID.DerivativeFilterTime),
+			DerivativeFilterN:    string(in.Spec.PID.DerivativeFilterN),
+			AntiWindup:           in.Spec.PID.AntiWindup,
+			TrackingGain:         string(in.Spec.PID.TrackingGain),
+			IntegralMin:          string(in.Spec.PID.IntegralMin),
+			IntegralMax:          string(in.Spec.PID.IntegralMax),
+			SetpointWeightP:      string(in.Spec.PID.SetpointWeightP),
+			SetpointWeightD:      string(in.Spec.PID.SetpointWeightD),
+			SetpointRampRate:     string(in.Spec.PID.SetpointRampRate),
+			Deadband:             in.Spec.PID.Deadband,
+		},
+		Target: TargetSettings{
+			Deployment:     data.Deployment,
+			ScaleTargetRef: &in.Spec.Target.ScaleTargetRef,
+			Namespace:      in.Spec.Target.Namespace,
+			MinReplicas:    in.Spec.Target.MinReplicas,
+			MaxReplicas:    in.Spec.Target.MaxReplicas,
+			Behavior:       in.Spec.Target.Behavior,
+		},
+		Interval:        in.Spec.Interval,
+		CooldownTimeout: in.Spec.CooldownTimeout,
+	}
+	// keep the v1 spec as it was written unless scaleTargetRef was changed through v2 since
+	derived := TargetSettings{Deployment: data.Deployment}
+	if data.DerivedScaleTargetRef && derived.GetScaleTargetRef() == in.Spec.Target.ScaleTargetRef {
+		dst.Spec.Target.ScaleTargetRef = nil
+	}
+	if kafka := in.Spec.Kafka; kafka != nil {
+		dst.Spec.Kafka = &KafkaSettings{
+			Brokers:              kafka.Brokers,
+			Topic:                kafka.Topic,
+			Topics:               kafka.Topics,
+			TopicPattern:         kafka.TopicPattern,
+			Aggregation:          kafka.Aggregation,
+			LagMode:              kafka.LagMode,
+			Group:                kafka.Group,
+			UseSASL:              kafka.UseSASL,
+			SASLMechanism:        kafka.SASLMechanism,
+			Username:             kafka.Username,
+			Password:             kafka.Password,
+			CredentialsSecretRef: (*CredentialsSecretRef)(kafka.CredentialsSecretRef),
+			OAuth:                (*KafkaOAuthSettings)(kafka.OAuth),
+			CapToPartitions:      kafka.CapToPartitions,
+			PartitionLagMetrics:  kafka.PartitionLagMetrics,
+			GroupStatePolicy:     (*GroupStatePolicy)(kafka.GroupStatePolicy),
+		}
+		if tls := kafka.TLS; tls != nil {
+			dst.Spec.Kafka.TLS = &KafkaTLSSettings{
+				Enable:             tls.Enable,
+				CASecretRef:        (*SecretKeyRef)(tls.CASecretRef),
+				CertSecretRef:      (*SecretKeyRef)(tls.CertSecretRef),
+				KeySecretRef:       (*SecretKeyRef)(tls.KeySecretRef),
+				InsecureSkipVerify: tls.InsecureSkipVerify,
+				ServerName:         tls.ServerName,
+			}
+		}
+	}
+	dst.Status = PIDScalerStatus{
+		Status:             in.Status.Status,
+		Message:            in.Status.Message,
+		UpdateTime:         in.Status.UpdateTime,
+		GroupState:         in.Status.GroupState,
+		ObservedGeneration: in.Status.ObservedGeneration,
+		LastMeasuredValue:  in.Status.LastMeasuredValue,
+		LastOutput:         in.Status.LastOutput,
+		CurrentReplicas:    in.Status.CurrentReplicas,
+		DesiredReplicas:    in.Status.DesiredReplicas,
+		LastScaleTime:      in.Status.LastScaleTime,
+		PIDState:           (*PIDStateSnapshot)(in.Status.PIDState),
+		Conditions:         in.Status.Conditions,
+	}
+	return nil
+}
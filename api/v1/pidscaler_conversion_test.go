@@ -0,0 +1,114 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v2 "github.com/timson/pidhpa-operator/api/v2"
+)
+
+func conversionFuzzer() *fuzz.Fuzzer {
+	return fuzz.New().NilChance(0.3).Funcs(
+		func(m *metav1.ObjectMeta, c fuzz.Continue) {
+			m.Name = c.RandString()
+			m.Namespace = c.RandString()
+			m.Generation = c.Int63()
+			c.Fuzz(&m.Labels)
+			c.Fuzz(&m.Annotations)
+		},
+	)
+}
+
+func TestConvertPIDScalerExample(t *testing.T) {
+	ps := validPIDScaler()
+	ps.Spec.Target.ScaleTargetRef = nil
+	ps.Spec.Target.Deployment = "app"
+	ps.Spec.Kafka.Username = "user"
+	ps.Spec.Kafka.Password = "secret"
+
+	hub := &v2.PIDScaler{}
+	if err := ps.ConvertTo(hub); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ref := hub.Spec.Target.ScaleTargetRef
+	if ref.APIVersion != DefaultScaleTargetAPIVersion || ref.Kind != DefaultScaleTargetKind || ref.Name != "app" {
+		t.Errorf("scaleTargetRef should be derived from the deployment, got %+v", ref)
+	}
+	if hub.Spec.PID.Kp != "0.1" || hub.Spec.Kafka.Group != "consumers" {
+		t.Errorf("Unexpected v2 spec %+v", hub.Spec)
+	}
+	if _, ok := hub.Annotations[ConversionDataAnnotation]; !ok {
+		t.Errorf("Deprecated fields should be kept in the %s annotation", ConversionDataAnnotation)
+	}
+	if strings.Contains(hub.Annotations[ConversionDataAnnotation], "secret") {
+		t.Errorf("Credentials should not be copied into the %s annotation", ConversionDataAnnotation)
+	}
+	if hub.Spec.Kafka.Username != "user" || hub.Spec.Kafka.Password != "secret" {
+		t.Errorf("Credentials should be kept in the deprecated v2 fields, got %+v", hub.Spec.Kafka)
+	}
+
+	// scaleTargetRef changed through v2 is kept by v1 clients
+	hub.Spec.Target.ScaleTargetRef.Name = "other"
+	back := &PIDScaler{}
+	if err := back.ConvertFrom(hub); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if back.Spec.Target.ScaleTargetRef == nil || back.Spec.Target.ScaleTargetRef.Name != "other" {
+		t.Errorf("Unexpected scaleTargetRef %+v", back.Spec.Target.ScaleTargetRef)
+	}
+	if back.Spec.Kafka.Username != "user" || back.Spec.Target.Deployment != "app" {
+		t.Errorf("Deprecated fields should be restored, got %+v", back.Spec)
+	}
+	if _, ok := back.Annotations[ConversionDataAnnotation]; ok {
+		t.Errorf("The %s annotation should not be visible in v1", ConversionDataAnnotation)
+	}
+}
+
+func TestFuzzPIDScalerRoundTripFromV1(t *testing.T) {
+	f := conversionFuzzer()
+	for i := 0; i < 1000; i++ {
+		spoke := &PIDScaler{}
+		f.Fuzz(&spoke.ObjectMeta)
+		f.Fuzz(&spoke.Spec)
+		f.Fuzz(&spoke.Status)
+
+		hub := &v2.PIDScaler{}
+		if err := spoke.ConvertTo(hub); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		back := &PIDScaler{}
+		if err := back.ConvertFrom(hub); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !apiequality.Semantic.DeepEqual(spoke, back) {
+			t.Fatalf("v1 -> v2 -> v1 round trip is lossy:\n%s", cmp.Diff(spoke, back))
+		}
+	}
+}
+
+func TestFuzzPIDScalerRoundTripFromV2(t *testing.T) {
+	f := conversionFuzzer()
+	for i := 0; i < 1000; i++ {
+		hub := &v2.PIDScaler{}
+		f.Fuzz(&hub.ObjectMeta)
+		f.Fuzz(&hub.Spec)
+		f.Fuzz(&hub.Status)
+
+		spoke := &PIDScaler{}
+		if err := spoke.ConvertFrom(hub); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		back := &v2.PIDScaler{}
+		if err := spoke.ConvertTo(back); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !apiequality.Semantic.DeepEqual(hub, back) {
+			t.Fatalf("v2 -> v1 -> v2 round trip is lossy:\n%s", cmp.Diff(hub, back))
+		}
+	}
+}
@@ -17,8 +17,11 @@ limitations under the License.
 package v1
 
 import (
+	"math"
 	"strconv"
+	"strings"
 
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -36,31 +39,364 @@ type OperatorStatus struct {
 	UpdateTime metav1.Time `json:"update_time,omitempty"`
 }
 
+// Condition types reported in PIDScaler status
+const (
+	// ConditionReady is true when the spec was accepted and a worker is running for it
+	ConditionReady = "Ready"
+	// ConditionMetricAvailable is true when the last read of the metric source succeeded
+	ConditionMetricAvailable = "MetricAvailable"
+	// ConditionScalingActive is true when the worker can compute and apply a replica count
+	ConditionScalingActive = "ScalingActive"
+	// ConditionScalingLimited is true when the desired replica count is held at the min or max replicas or by the
+	// scaling behavior
+	ConditionScalingLimited = "ScalingLimited"
+)
+
+// Condition reasons reported in PIDScaler status
+const (
+	ReasonReconciling        = "Reconciling"
+	ReasonReconciled         = "Reconciled"
+	ReasonInvalidSpec        = "InvalidSpec"
+	ReasonSecretError        = "SecretError"
+	ReasonFailedScale        = "FailedScale"
+	ReasonFailedGetCRD       = "FailedGetResource"
+	ReasonValidMetricFound   = "ValidMetricFound"
+	ReasonMetricNotReady     = "MetricNotReady"
+	ReasonFailedGetMetric    = "FailedGetMetric"
+	ReasonFailedGetTarget    = "FailedGetTarget"
+	ReasonTooFewReplicas     = "TooFewReplicas"
+	ReasonTooManyReplicas    = "TooManyReplicas"
+	ReasonCappedToPartitions = "CappedToPartitions"
+	ReasonDesiredWithinRange = "DesiredWithinRange"
+	ReasonScaleUpLimit       = "ScaleUpLimit"
+	ReasonScaleDownLimit     = "ScaleDownLimit"
+)
+
+const (
+	PIDModePositional = "positional"
+	PIDModeVelocity   = "velocity"
+)
+
+const (
+	DerivativeOnError       = "error"
+	DerivativeOnMeasurement = "measurement"
+)
+
+const (
+	AntiWindupConditional     = "conditional"
+	AntiWindupBackCalculation = "back_calculation"
+	AntiWindupClamp           = "clamp"
+)
+
+const (
+	SourceTypeKafka      = "kafka"
+	SourceTypePrometheus = "prometheus"
+)
+
+const (
+	SASLMechanismPlain       = "plain"
+	SASLMechanismScramSha256 = "scram_sha256"
+	SASLMechanismScramSha512 = "scram_sha512"
+	SASLMechanismOAuthBearer = "oauthbearer"
+)
+
+// SASLMechanisms lists the SASL mechanisms supported by the Kafka source
+var SASLMechanisms = []string{SASLMechanismPlain, SASLMechanismScramSha256, SASLMechanismScramSha512,
+	SASLMechanismOAuthBearer}
+
+// PrometheusSettings configures an instant PromQL query used as the process variable
+type PrometheusSettings struct {
+	// Address of the Prometheus HTTP API, e.g. http://prometheus.monitoring:9090
+	Address string `json:"address"`
+	// Query must evaluate to a scalar or to a vector with exactly one series
+	Query string `json:"query"`
+	// Timeout of a single query in seconds
+	// +optional
+	Timeout int32 `json:"timeout,omitempty"`
+}
+
+// SourceSettings selects the metric source used as the PID process variable
+type SourceSettings struct {
+	// +kubebuilder:validation:Enum=kafka;prometheus
+	// +kubebuilder:default=kafka
+	Type string `json:"type"`
+	// Prometheus settings, required when type is prometheus
+	// +optional
+	Prometheus *PrometheusSettings `json:"prometheus,omitempty"`
+}
+
+// GetType returns the configured source type, defaulting to Kafka for specs created before sources were introduced
+func (s *SourceSettings) GetType() string {
+	if s.Type == "" {
+		return SourceTypeKafka
+	}
+	return s.Type
+}
+
+const (
+	DefaultInterval          = 15
+	DefaultCooldownTimeout   = 60
+	DefaultPrometheusTimeout = 10
+	DefaultAggregation       = "sum"
+	DefaultLagMode           = "offsets"
+	DefaultPIDMode           = PIDModePositional
+	DefaultDerivativeOn      = DerivativeOnError
+	DefaultAntiWindup        = AntiWindupConditional
+)
+
+const (
+	DefaultScaleTargetAPIVersion = "apps/v1"
+	DefaultScaleTargetKind       = "Deployment"
+)
+
+// Limits of the scaling rules in a behavior, the same as for the HorizontalPodAutoscaler
+const (
+	MaxStabilizationWindowSeconds = 3600
+	MaxPolicyPeriodSeconds        = 1800
+)
+
+const (
+	DefaultUsernameKey = "username"
+	DefaultPasswordKey = "password"
+)
+
+// CredentialsSecretRef references a Secret in the PIDScaler namespace holding SASL credentials
+type CredentialsSecretRef struct {
+	Name string `json:"name"`
+	// +kubebuilder:default=username
+	// +optional
+	UsernameKey string `json:"usernameKey,omitempty"`
+	// +kubebuilder:default=password
+	// +optional
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// GetTopics returns Topic and Topics combined
+func (s *KafkaSettings) GetTopics() []string {
+	if s.Topic == "" {
+		return s.Topics
+	}
+	topics := []string{s.Topic}
+	for _, topic := range s.Topics {
+		if topic != s.Topic {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+func (r *CredentialsSecretRef) GetUsernameKey() string {
+	if r.UsernameKey == "" {
+		return DefaultUsernameKey
+	}
+	return r.UsernameKey
+}
+
+func (r *CredentialsSecretRef) GetPasswordKey() string {
+	if r.PasswordKey == "" {
+		return DefaultPasswordKey
+	}
+	return r.PasswordKey
+}
+
+// SecretKeyRef selects a key of a Secret in the PIDScaler namespace
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// KafkaTLSSettings configures TLS for broker connections, certificates are PEM encoded
+type KafkaTLSSettings struct {
+	Enable bool `json:"enable"`
+	// CA bundle used to verify brokers, system roots are used when not set
+	// +optional
+	CASecretRef *SecretKeyRef `json:"caSecretRef,omitempty"`
+	// Client certificate for mTLS, requires KeySecretRef
+	// +optional
+	CertSecretRef *SecretKeyRef `json:"certSecretRef,omitempty"`
+	// Client private key for mTLS, requires CertSecretRef
+	// +optional
+	KeySecretRef *SecretKeyRef `json:"keySecretRef,omitempty"`
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// Overrides the server name used to verify broker certificates
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// KafkaOAuthSettings configures the oauthbearer SASL mechanism, the OAuth client ID and secret
+// are read from CredentialsSecretRef as username and password
+type KafkaOAuthSettings struct {
+	// Token endpoint of the identity provider used for the client credentials grant
+	TokenURL string `json:"tokenURL"`
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// Actions of the group state policy
+const (
+	GroupStateActionCompute = "Compute"
+	GroupStateActionSkip    = "Skip"
+	GroupStateActionError   = "Error"
+)
+
+// GroupStatePolicy configures how lag is read while the consumer group is not Stable: Compute reads lag
+// from committed offsets, Skip skips the tick and Error reports a failure
+type GroupStatePolicy struct {
+	// Action while no consumer is running, defaults to Compute
+	// +kubebuilder:validation:Enum=Compute;Skip;Error
+	// +optional
+	Empty string `json:"empty,omitempty"`
+	// Action while the group waits for members to rejoin, defaults to Compute
+	// +kubebuilder:validation:Enum=Compute;Skip;Error
+	// +optional
+	PreparingRebalance string `json:"preparingRebalance,omitempty"`
+	// Action while partitions are being assigned, defaults to Skip
+	// +kubebuilder:validation:Enum=Compute;Skip;Error
+	// +optional
+	CompletingRebalance string `json:"completingRebalance,omitempty"`
+	// Action when the group has no members and no committed offsets, defaults to Error
+	// +kubebuilder:validation:Enum=Compute;Skip;Error
+	// +optional
+	Dead string `json:"dead,omitempty"`
+}
+
 type KafkaSettings struct {
-	Brokers       []string `json:"brokers"`
-	Topic         string   `json:"topic"`
-	Group         string   `json:"group"`
-	UseSASL       bool     `json:"use_sasl,omitempty"`
-	SASLMechanism string   `json:"sasl_mechanism,omitempty"`
-	Username      string   `json:"username,omitempty"`
-	Password      string   `json:"password,omitempty"`
+	Brokers []string `json:"brokers"`
+	// Single topic to track, kept for compatibility, it is combined with Topics and TopicPattern
+	// +optional
+	Topic string `json:"topic,omitempty"`
+	// +optional
+	Topics []string `json:"topics,omitempty"`
+	// Regular expression matched against the whole name of topics consumed by the group
+	// +optional
+	TopicPattern string `json:"topicPattern,omitempty"`
+	// How lag of the selected topics is combined into the controlled variable
+	// +kubebuilder:validation:Enum=sum;max;mean
+	// +kubebuilder:default=sum
+	// +optional
+	Aggregation string `json:"aggregation,omitempty"`
+	// Controlled variable: offsets (messages behind) or time (estimated seconds behind,
+	// derived from the lag and the observed produce rate of each topic)
+	// +kubebuilder:validation:Enum=offsets;time
+	// +kubebuilder:default=offsets
+	// +optional
+	LagMode       string `json:"lagMode,omitempty"`
+	Group         string `json:"group"`
+	UseSASL       bool   `json:"use_sasl,omitempty"`
+	SASLMechanism string `json:"sasl_mechanism,omitempty"`
+	// Deprecated: use CredentialsSecretRef instead of storing credentials in the spec
+	Username string `json:"username,omitempty"`
+	// Deprecated: use CredentialsSecretRef instead of storing credentials in the spec
+	Password string `json:"password,omitempty"`
+	// SASL credentials read from a Secret, takes precedence over Username and Password
+	// +optional
+	CredentialsSecretRef *CredentialsSecretRef `json:"credentialsSecretRef,omitempty"`
+	// +optional
+	TLS *KafkaTLSSettings `json:"tls,omitempty"`
+	// Required when SASLMechanism is oauthbearer
+	// +optional
+	OAuth *KafkaOAuthSettings `json:"oauth,omitempty"`
+	// Clamp the regulator output to the partition count of the selected topics,
+	// consumers beyond that count would stay idle
+	// +optional
+	CapToPartitions bool `json:"capToPartitions,omitempty"`
+	// Publish lag of every partition as the kafka_partition_lag metric
+	// +optional
+	PartitionLagMetrics bool `json:"partitionLagMetrics,omitempty"`
+	// +optional
+	GroupStatePolicy *GroupStatePolicy `json:"groupStatePolicy,omitempty"`
 }
 
 type TargetSettings struct {
-	Deployment  string `json:"deployment"`
-	Namespace   string `json:"namespace"`
+	// Deprecated: use ScaleTargetRef, kept as a shortcut for an apps/v1 Deployment
+	// +optional
+	Deployment string `json:"deployment,omitempty"`
+	// Resource scaled through its scale subresource, e.g. a Deployment, StatefulSet, Argo Rollout or any custom resource
+	// +optional
+	ScaleTargetRef *autoscalingv2.CrossVersionObjectReference `json:"scaleTargetRef,omitempty"`
+	// Namespace of the target, defaults to the PIDScaler namespace
+	// +optional
+	Namespace   string `json:"namespace,omitempty"`
 	MinReplicas int32  `json:"min_replicas"`
 	MaxReplicas int32  `json:"max_replicas"`
-	// PID Regulator output will set desired replicas, and the controller will scale the deployment to this number in the next reconciliation
-	DesiredReplicas *int32      `json:"desired_replicas,omitempty"`
-	UpdateTime      metav1.Time `json:"update_time,omitempty"`
+	// Scaling behavior of the HorizontalPodAutoscaler applied between the PID output and the scale of the target,
+	// the replica changes are not limited when it is not set
+	// +optional
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+// GetScaleTargetRef returns the scaled resource, falling back to the deprecated Deployment field
+func (s *TargetSettings) GetScaleTargetRef() autoscalingv2.CrossVersionObjectReference {
+	if s.ScaleTargetRef != nil {
+		ref := *s.ScaleTargetRef
+		if ref.APIVersion == "" {
+			ref.APIVersion = DefaultScaleTargetAPIVersion
+		}
+		return ref
+	}
+	return autoscalingv2.CrossVersionObjectReference{
+		APIVersion: DefaultScaleTargetAPIVersion,
+		Kind:       DefaultScaleTargetKind,
+		Name:       s.Deployment,
+	}
 }
 
 type PIDSettings struct {
-	Ki              string `json:"ki"`
-	Kp              string `json:"kp"`
-	Kd              string `json:"kd"`
+	// Form of the controller: positional computes the replicas from the P, I and D terms, velocity adds the
+	// change of the terms to the current replicas of the target, so manual scaling and changes of the replica
+	// limits are taken into account. Defaults to positional
+	// +kubebuilder:validation:Enum=positional;velocity
+	// +optional
+	Mode string `json:"mode,omitempty"`
+	Ki   string `json:"ki"`
+	Kp   string `json:"kp"`
+	// Derivative gain, defaults to 0
+	// +optional
+	Kd              string `json:"kd,omitempty"`
 	ReferenceSignal int64  `json:"reference_signal"`
+	// Differentiate the error or the measured value, the latter avoids a derivative kick when reference_signal
+	// changes. Defaults to error
+	// +kubebuilder:validation:Enum=error;measurement
+	// +optional
+	DerivativeOn string `json:"derivative_on,omitempty"`
+	// Time constant in seconds of the low-pass filter of the derivative term
+	// +optional
+	DerivativeFilterTime string `json:"derivative_filter_time,omitempty"`
+	// Sets the time constant of the derivative filter to Kd/(Kp*N) when derivative_filter_time is not set,
+	// typical values are between 2 and 20. The derivative is not filtered when both are empty
+	// +optional
+	DerivativeFilterN string `json:"derivative_filter_n,omitempty"`
+	// Anti-windup strategy: conditional stops integrating while the output is saturated, back_calculation
+	// unwinds the integral by tracking_gain times the excess over the replica limits and clamp keeps the
+	// integral term between integral_min and integral_max. Defaults to conditional
+	// +kubebuilder:validation:Enum=conditional;back_calculation;clamp
+	// +optional
+	AntiWindup string `json:"anti_windup,omitempty"`
+	// Back-calculation tracking gain in 1/s, the integral tracks the replica limits within one interval when empty
+	// +optional
+	TrackingGain string `json:"tracking_gain,omitempty"`
+	// Lower limit of the integral term in replicas for the clamp strategy, defaults to min_replicas
+	// +optional
+	IntegralMin string `json:"integral_min,omitempty"`
+	// Upper limit of the integral term in replicas for the clamp strategy, defaults to max_replicas
+	// +optional
+	IntegralMax string `json:"integral_max,omitempty"`
+	// Weight b of reference_signal in the proportional term, values below 1 soften the response to changes of
+	// reference_signal. Defaults to 1
+	// +optional
+	SetpointWeightP string `json:"setpoint_weight_p,omitempty"`
+	// Weight c of reference_signal in the derivative term when derivative_on is error. Defaults to 1
+	// +optional
+	SetpointWeightD string `json:"setpoint_weight_d,omitempty"`
+	// Maximum change of the effective reference signal per second, a new reference_signal is approached
+	// gradually instead of in a single step. Not limited when empty
+	// +optional
+	SetpointRampRate string `json:"setpoint_ramp_rate,omitempty"`
+	// Width of the band around reference_signal in which the replicas are held and the integral is frozen,
+	// either absolute like "50" or a percentage of reference_signal like "5%". Disabled when empty
+	// +optional
+	Deadband string `json:"deadband,omitempty"`
 }
 
 func (s *PIDSettings) getFloat(v string) float64 {
@@ -80,13 +416,101 @@ func (s *PIDSettings) GetKd() float64 {
 	return s.getFloat(s.Kd)
 }
 
+func (s *PIDSettings) GetDerivativeFilterTime() float64 {
+	return s.getFloat(s.DerivativeFilterTime)
+}
+
+func (s *PIDSettings) GetDerivativeFilterN() float64 {
+	return s.getFloat(s.DerivativeFilterN)
+}
+
+// GetSetpointWeightP returns the setpoint weight of the proportional term, 1 when it is not set
+func (s *PIDSettings) GetSetpointWeightP() float64 {
+	if s.SetpointWeightP == "" {
+		return 1
+	}
+	return s.getFloat(s.SetpointWeightP)
+}
+
+// GetSetpointWeightD returns the setpoint weight of the derivative term, 1 when it is not set
+func (s *PIDSettings) GetSetpointWeightD() float64 {
+	if s.SetpointWeightD == "" {
+		return 1
+	}
+	return s.getFloat(s.SetpointWeightD)
+}
+
+func (s *PIDSettings) GetSetpointRampRate() float64 {
+	return s.getFloat(s.SetpointRampRate)
+}
+
+// GetDeadband returns the absolute width of the deadband, resolving a percentage against reference_signal
+func (s *PIDSettings) GetDeadband() float64 {
+	if percent, ok := strings.CutSuffix(s.Deadband, "%"); ok {
+		return s.getFloat(percent) / 100 * math.Abs(float64(s.ReferenceSignal))
+	}
+	return s.getFloat(s.Deadband)
+}
+
+func (s *PIDSettings) GetTrackingGain() float64 {
+	return s.getFloat(s.TrackingGain)
+}
+
+// GetIntegralMin returns the lower limit of the integral term, -Inf when it is not set
+func (s *PIDSettings) GetIntegralMin() float64 {
+	if s.IntegralMin == "" {
+		return math.Inf(-1)
+	}
+	return s.getFloat(s.IntegralMin)
+}
+
+// GetIntegralMax returns the upper limit of the integral term, +Inf when it is not set
+func (s *PIDSettings) GetIntegralMax() float64 {
+	if s.IntegralMax == "" {
+		return math.Inf(1)
+	}
+	return s.getFloat(s.IntegralMax)
+}
+
 // PIDScalerSpec defines the desired state of PIDScaler
 type PIDScalerSpec struct {
-	Kafka           KafkaSettings  `json:"kafka"`
-	PID             PIDSettings    `json:"pid"`
-	Target          TargetSettings `json:"target"`
-	Interval        int32          `json:"interval"`
-	CooldownTimeout int32          `json:"cooldown_timeout"`
+	// +optional
+	// +kubebuilder:default={type: kafka}
+	Source SourceSettings `json:"source,omitempty"`
+	// Kafka settings, required when source type is kafka
+	// +optional
+	Kafka  *KafkaSettings `json:"kafka,omitempty"`
+	PID    PIDSettings    `json:"pid"`
+	Target TargetSettings `json:"target"`
+	// Seconds between two reads of the metric source, defaults to 15
+	// +optional
+	Interval int32 `json:"interval,omitempty"`
+	// Minimum seconds between two scaling actions, defaults to 60
+	// +optional
+	CooldownTimeout int32 `json:"cooldown_timeout,omitempty"`
+}
+
+// PIDStateSnapshot is the state of the PID controller, a worker started after an operator restart or a leader
+// change continues from it unless it is stale
+type PIDStateSnapshot struct {
+	// Integral accumulator
+	Integral string `json:"integral"`
+	// Error of the last update
+	PrevError string `json:"prevError"`
+	// Measured value of the last update
+	// +optional
+	PrevMeasurement string `json:"prevMeasurement,omitempty"`
+	// Filtered derivative term of the last update
+	// +optional
+	Derivative string `json:"derivative,omitempty"`
+	// Output bias that holds the integral term while Ki is 0
+	// +optional
+	Bias string `json:"bias,omitempty"`
+	// Time of the last update
+	PrevTime metav1.MicroTime `json:"prevTime"`
+	// Start of the current cooldown period
+	// +optional
+	LastScale *metav1.Time `json:"lastScale,omitempty"`
 }
 
 // PIDScalerStatus defines the observed state of PIDScaler
@@ -94,10 +518,44 @@ type PIDScalerStatus struct {
 	Status     string      `json:"status"`
 	Message    string      `json:"message,omitempty"`
 	UpdateTime metav1.Time `json:"update_time,omitempty"`
+	// Last observed state of the Kafka consumer group
+	// +optional
+	GroupState string `json:"groupState,omitempty"`
+	// Generation of the spec the Ready condition refers to
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Last value read from the metric source
+	// +optional
+	LastMeasuredValue string `json:"lastMeasuredValue,omitempty"`
+	// Last PID controller output before rounding
+	// +optional
+	LastOutput string `json:"lastOutput,omitempty"`
+	// Number of replicas of the target as last observed
+	// +optional
+	CurrentReplicas int32 `json:"currentReplicas,omitempty"`
+	// Number of replicas last computed by the PID controller, the worker scales the target to it
+	// +optional
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+	// Last time the target was scaled
+	// +optional
+	LastScaleTime *metav1.Time `json:"lastScaleTime,omitempty"`
+	// State of the PID controller, written at every update
+	// +optional
+	PIDState *PIDStateSnapshot `json:"pidState,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Current",type=integer,JSONPath=`.status.currentReplicas`
+// +kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredReplicas`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // PIDScaler is the Schema for the pidscalers API
 type PIDScaler struct {
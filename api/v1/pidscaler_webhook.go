@@ -0,0 +1,367 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var pidscalerlog = logf.Log.WithName("pidscaler-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks
+func (r *PIDScaler) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&PIDScalerDefaulter{}).
+		WithValidator(&PIDScalerValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-pidscaler-ts-v1-pidscaler,mutating=true,failurePolicy=fail,sideEffects=None,groups=pidscaler.ts,resources=pidscalers,verbs=create;update,versions=v1,name=mpidscaler.kb.io,admissionReviewVersions=v1
+
+// PIDScalerDefaulter fills the fields left empty in PIDScaler specs
+type PIDScalerDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &PIDScalerDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *PIDScalerDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	pidScaler, ok := obj.(*PIDScaler)
+	if !ok {
+		return fmt.Errorf("expected a PIDScaler but got a %T", obj)
+	}
+	pidscalerlog.Info("default", "name", pidScaler.Name)
+	pidScaler.SetDefaults()
+	return nil
+}
+
+// SetDefaults fills the fields left empty in the spec. It is applied by the defaulting webhook and by the
+// operator itself, so PIDScalers created while webhooks are disabled behave the same.
+func (r *PIDScaler) SetDefaults() {
+	spec := &r.Spec
+	if spec.Source.Type == "" {
+		spec.Source.Type = SourceTypeKafka
+	}
+	if spec.Source.Prometheus != nil && spec.Source.Prometheus.Timeout == 0 {
+		spec.Source.Prometheus.Timeout = DefaultPrometheusTimeout
+	}
+	if spec.Target.Namespace == "" {
+		spec.Target.Namespace = r.Namespace
+	}
+	if ref := spec.Target.ScaleTargetRef; ref != nil && ref.APIVersion == "" {
+		ref.APIVersion = DefaultScaleTargetAPIVersion
+	}
+	if spec.PID.Kd == "" {
+		spec.PID.Kd = "0"
+	}
+	if spec.PID.Mode == "" {
+		spec.PID.Mode = DefaultPIDMode
+	}
+	if spec.PID.DerivativeOn == "" {
+		spec.PID.DerivativeOn = DefaultDerivativeOn
+	}
+	if spec.PID.AntiWindup == "" {
+		spec.PID.AntiWindup = DefaultAntiWindup
+	}
+	if spec.Interval == 0 {
+		spec.Interval = DefaultInterval
+	}
+	if spec.CooldownTimeout == 0 {
+		spec.CooldownTimeout = DefaultCooldownTimeout
+	}
+	if spec.Kafka != nil {
+		spec.Kafka.setDefaults()
+	}
+}
+
+func (s *KafkaSettings) setDefaults() {
+	if s.Aggregation == "" {
+		s.Aggregation = DefaultAggregation
+	}
+	if s.LagMode == "" {
+		s.LagMode = DefaultLagMode
+	}
+	if ref := s.CredentialsSecretRef; ref != nil {
+		ref.UsernameKey = ref.GetUsernameKey()
+		ref.PasswordKey = ref.GetPasswordKey()
+	}
+	if s.GroupStatePolicy == nil {
+		s.GroupStatePolicy = &GroupStatePolicy{}
+	}
+	for _, action := range []struct {
+		value        *string
+		defaultValue string
+	}{
+		{&s.GroupStatePolicy.Empty, GroupStateActionCompute},
+		{&s.GroupStatePolicy.PreparingRebalance, GroupStateActionCompute},
+		{&s.GroupStatePolicy.CompletingRebalance, GroupStateActionSkip},
+		{&s.GroupStatePolicy.Dead, GroupStateActionError},
+	} {
+		if *action.value == "" {
+			*action.value = action.defaultValue
+		}
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-pidscaler-ts-v1-pidscaler,mutating=false,failurePolicy=fail,sideEffects=None,groups=pidscaler.ts,resources=pidscalers,verbs=create;update,versions=v1,name=vpidscaler.kb.io,admissionReviewVersions=v1
+
+// PIDScalerValidator rejects PIDScalers the operator can't run
+type PIDScalerValidator struct{}
+
+var _ webhook.CustomValidator = &PIDScalerValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *PIDScalerValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	pidScaler, ok := obj.(*PIDScaler)
+	if !ok {
+		return nil, fmt.Errorf("expected a PIDScaler but got a %T", obj)
+	}
+	pidscalerlog.Info("validate create", "name", pidScaler.Name)
+	return pidScaler.warnings(), pidScaler.Validate()
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *PIDScalerValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	pidScaler, ok := newObj.(*PIDScaler)
+	if !ok {
+		return nil, fmt.Errorf("expected a PIDScaler but got a %T", newObj)
+	}
+	pidscalerlog.Info("validate update", "name", pidScaler.Name)
+	return pidScaler.warnings(), pidScaler.Validate()
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *PIDScalerValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// Validate returns an Invalid error listing every malformed field of the spec. It is applied by the validating
+// webhook and by the operator itself, so PIDScalers created while webhooks are disabled are rejected too.
+func (r *PIDScaler) Validate() error {
+	specPath := field.NewPath("spec")
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, r.Spec.PID.validate(specPath.Child("pid"))...)
+	allErrs = append(allErrs, r.Spec.Target.validate(specPath.Child("target"))...)
+	if r.Spec.Interval <= 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("interval"), r.Spec.Interval, "must be positive"))
+	}
+	if r.Spec.CooldownTimeout <= 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("cooldown_timeout"), r.Spec.CooldownTimeout, "must be positive"))
+	}
+
+	switch r.Spec.Source.GetType() {
+	case SourceTypeKafka:
+		if r.Spec.Kafka == nil {
+			allErrs = append(allErrs, field.Required(specPath.Child("kafka"), "required when source type is kafka"))
+		} else {
+			allErrs = append(allErrs, r.Spec.Kafka.validate(specPath.Child("kafka"))...)
+		}
+	case SourceTypePrometheus:
+		allErrs = append(allErrs, r.Spec.Source.validatePrometheus(specPath.Child("source", "prometheus"))...)
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("PIDScaler").GroupKind(), r.Name, allErrs)
+}
+
+// warnings reports the use of deprecated fields
+func (r *PIDScaler) warnings() admission.Warnings {
+	var warnings admission.Warnings
+	if r.Spec.Target.Deployment != "" {
+		warnings = append(warnings, "spec.target.deployment is deprecated, use spec.target.scaleTargetRef")
+	}
+	if r.Spec.Kafka != nil && (r.Spec.Kafka.Username != "" || r.Spec.Kafka.Password != "") {
+		warnings = append(warnings, "spec.kafka.username and spec.kafka.password are deprecated, use spec.kafka.credentialsSecretRef")
+	}
+	return warnings
+}
+
+// Decimal formats of the v2 schema, v1 values are held to them so they convert to valid v2 objects
+var (
+	decimalPattern       = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+	signedDecimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	deadbandPattern      = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?%?$`)
+)
+
+func (s *PIDSettings) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, gain := range []struct {
+		name     string
+		value    string
+		optional bool
+		pattern  *regexp.Regexp
+	}{
+		{"kp", s.Kp, false, decimalPattern}, {"ki", s.Ki, false, decimalPattern}, {"kd", s.Kd, false, decimalPattern},
+		{"derivative_filter_time", s.DerivativeFilterTime, true, decimalPattern},
+		{"derivative_filter_n", s.DerivativeFilterN, true, decimalPattern},
+		{"tracking_gain", s.TrackingGain, true, decimalPattern},
+		{"setpoint_weight_p", s.SetpointWeightP, true, decimalPattern},
+		{"setpoint_weight_d", s.SetpointWeightD, true, decimalPattern},
+		{"setpoint_ramp_rate", s.SetpointRampRate, true, decimalPattern},
+		{"deadband", s.Deadband, true, deadbandPattern},
+	} {
+		if gain.optional && gain.value == "" {
+			continue
+		}
+		if gain.pattern.MatchString(gain.value) {
+			continue
+		}
+		if signedDecimalPattern.MatchString(strings.TrimSuffix(gain.value, "%")) {
+			allErrs = append(allErrs, field.Invalid(path.Child(gain.name), gain.value, "must not be negative"))
+		} else {
+			allErrs = append(allErrs, field.Invalid(path.Child(gain.name), gain.value, "must be a decimal number like 0.01"))
+		}
+	}
+	limitsValid := true
+	for _, limit := range []struct {
+		name  string
+		value string
+	}{{"integral_min", s.IntegralMin}, {"integral_max", s.IntegralMax}} {
+		if limit.value != "" && !signedDecimalPattern.MatchString(limit.value) {
+			allErrs = append(allErrs, field.Invalid(path.Child(limit.name), limit.value, "must be a decimal number like -0.5"))
+			limitsValid = false
+		}
+	}
+	if limitsValid && s.GetIntegralMin() > s.GetIntegralMax() {
+		allErrs = append(allErrs, field.Invalid(path.Child("integral_max"), s.IntegralMax, "must not be less than integral_min"))
+	}
+	return allErrs
+}
+
+func (s *TargetSettings) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if s.ScaleTargetRef == nil && s.Deployment == "" {
+		allErrs = append(allErrs, field.Required(path.Child("scaleTargetRef"), "a scale target is required"))
+	}
+	if s.ScaleTargetRef != nil {
+		if s.ScaleTargetRef.Kind == "" {
+			allErrs = append(allErrs, field.Required(path.Child("scaleTargetRef", "kind"), ""))
+		}
+		if s.ScaleTargetRef.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("scaleTargetRef", "name"), ""))
+		}
+	}
+	if s.MinReplicas < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("min_replicas"), s.MinReplicas, "must not be negative"))
+	}
+	if s.MinReplicas > s.MaxReplicas {
+		allErrs = append(allErrs, field.Invalid(path.Child("max_replicas"), s.MaxReplicas,
+			fmt.Sprintf("must be greater than or equal to min_replicas (%d)", s.MinReplicas)))
+	}
+	if s.Behavior != nil {
+		allErrs = append(allErrs, validateScalingRules(s.Behavior.ScaleUp, path.Child("behavior", "scaleUp"))...)
+		allErrs = append(allErrs, validateScalingRules(s.Behavior.ScaleDown, path.Child("behavior", "scaleDown"))...)
+	}
+	return allErrs
+}
+
+// validateScalingRules checks the scaling rules of a behavior with the limits of the HorizontalPodAutoscaler
+func validateScalingRules(rules *autoscalingv2.HPAScalingRules, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if rules == nil {
+		return allErrs
+	}
+	if window := rules.StabilizationWindowSeconds; window != nil && (*window < 0 || *window > MaxStabilizationWindowSeconds) {
+		allErrs = append(allErrs, field.Invalid(path.Child("stabilizationWindowSeconds"), *window,
+			fmt.Sprintf("must be between 0 and %d", MaxStabilizationWindowSeconds)))
+	}
+	selectPolicies := []string{string(autoscalingv2.MaxChangePolicySelect), string(autoscalingv2.MinChangePolicySelect),
+		string(autoscalingv2.DisabledPolicySelect)}
+	if rules.SelectPolicy != nil && !slices.Contains(selectPolicies, string(*rules.SelectPolicy)) {
+		allErrs = append(allErrs, field.NotSupported(path.Child("selectPolicy"), *rules.SelectPolicy, selectPolicies))
+	}
+	policyTypes := []string{string(autoscalingv2.PodsScalingPolicy), string(autoscalingv2.PercentScalingPolicy)}
+	for i, policy := range rules.Policies {
+		policyPath := path.Child("policies").Index(i)
+		if !slices.Contains(policyTypes, string(policy.Type)) {
+			allErrs = append(allErrs, field.NotSupported(policyPath.Child("type"), policy.Type, policyTypes))
+		}
+		if policy.Value <= 0 {
+			allErrs = append(allErrs, field.Invalid(policyPath.Child("value"), policy.Value, "must be greater than zero"))
+		}
+		if policy.PeriodSeconds <= 0 || policy.PeriodSeconds > MaxPolicyPeriodSeconds {
+			allErrs = append(allErrs, field.Invalid(policyPath.Child("periodSeconds"), policy.PeriodSeconds,
+				fmt.Sprintf("must be between 1 and %d", MaxPolicyPeriodSeconds)))
+		}
+	}
+	return allErrs
+}
+
+func (s *KafkaSettings) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(s.Brokers) == 0 {
+		allErrs = append(allErrs, field.Required(path.Child("brokers"), "at least one broker is required"))
+	}
+	for i, broker := range s.Brokers {
+		if broker == "" {
+			allErrs = append(allErrs, field.Invalid(path.Child("brokers").Index(i), broker, "must not be empty"))
+		}
+	}
+	if s.Group == "" {
+		allErrs = append(allErrs, field.Required(path.Child("group"), ""))
+	}
+	if len(s.GetTopics()) == 0 && s.TopicPattern == "" {
+		allErrs = append(allErrs, field.Required(path.Child("topic"), "one of topic, topics or topicPattern is required"))
+	}
+	if s.TopicPattern != "" {
+		if _, err := regexp.Compile(s.TopicPattern); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("topicPattern"), s.TopicPattern, err.Error()))
+		}
+	}
+	if s.UseSASL {
+		if !slices.Contains(SASLMechanisms, s.SASLMechanism) {
+			allErrs = append(allErrs, field.NotSupported(path.Child("sasl_mechanism"), s.SASLMechanism, SASLMechanisms))
+		}
+		if s.SASLMechanism == SASLMechanismOAuthBearer && (s.OAuth == nil || s.OAuth.TokenURL == "") {
+			allErrs = append(allErrs, field.Required(path.Child("oauth", "tokenURL"), "required by the oauthbearer mechanism"))
+		}
+	}
+	return allErrs
+}
+
+func (s *SourceSettings) validatePrometheus(path *field.Path) field.ErrorList {
+	if s.Prometheus == nil {
+		return field.ErrorList{field.Required(path, "required when source type is prometheus")}
+	}
+	var allErrs field.ErrorList
+	if s.Prometheus.Address == "" {
+		allErrs = append(allErrs, field.Required(path.Child("address"), ""))
+	}
+	if s.Prometheus.Query == "" {
+		allErrs = append(allErrs, field.Required(path.Child("query"), ""))
+	}
+	if s.Prometheus.Timeout < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("timeout"), s.Prometheus.Timeout, "must not be negative"))
+	}
+	return allErrs
+}
@@ -0,0 +1,317 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func validPIDScaler() *PIDScaler {
+	return &PIDScaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "default"},
+		Spec: PIDScalerSpec{
+			Source: SourceSettings{Type: SourceTypeKafka},
+			Kafka: &KafkaSettings{
+				Brokers: []string{"kafka:9092"},
+				Topic:   "orders",
+				Group:   "consumers",
+			},
+			PID: PIDSettings{Kp: "0.1", Ki: "0.01", Kd: "0", ReferenceSignal: 10},
+			Target: TargetSettings{
+				ScaleTargetRef: &autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app"},
+				Namespace:      "default",
+				MinReplicas:    1,
+				MaxReplicas:    10,
+			},
+			Interval:        5,
+			CooldownTimeout: 30,
+		},
+	}
+}
+
+func TestValidatePIDScaler(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*PIDScaler)
+		fields []string
+	}{
+		{
+			name:   "Valid spec",
+			mutate: func(*PIDScaler) {},
+		},
+		{
+			name:   "Malformed gain",
+			mutate: func(ps *PIDScaler) { ps.Spec.PID.Kp = "0.1.2" },
+			fields: []string{"spec.pid.kp"},
+		},
+		{
+			name: "Decimal formats rejected by v2",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.PID.Kp = "1e-3"
+				ps.Spec.PID.Ki = "+0.5"
+				ps.Spec.PID.TrackingGain = "0x1p-4"
+				ps.Spec.PID.IntegralMin = "Inf"
+			},
+			fields: []string{"spec.pid.kp", "spec.pid.ki", "spec.pid.tracking_gain", "spec.pid.integral_min"},
+		},
+		{
+			name:   "Negative gain",
+			mutate: func(ps *PIDScaler) { ps.Spec.PID.Ki = "-1" },
+			fields: []string{"spec.pid.ki"},
+		},
+		{
+			name: "Malformed derivative filter",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.PID.DerivativeFilterTime = "1s"
+				ps.Spec.PID.DerivativeFilterN = "-2"
+			},
+			fields: []string{"spec.pid.derivative_filter_time", "spec.pid.derivative_filter_n"},
+		},
+		{
+			name: "Negative tracking gain",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.PID.AntiWindup = AntiWindupBackCalculation
+				ps.Spec.PID.TrackingGain = "-0.1"
+			},
+			fields: []string{"spec.pid.tracking_gain"},
+		},
+		{
+			name: "Integral min greater than max",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.PID.AntiWindup = AntiWindupClamp
+				ps.Spec.PID.IntegralMin = "3"
+				ps.Spec.PID.IntegralMax = "-1.5"
+			},
+			fields: []string{"spec.pid.integral_max"},
+		},
+		{
+			name: "Negative setpoint weight",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.PID.SetpointWeightP = "0.5"
+				ps.Spec.PID.SetpointWeightD = "-1"
+				ps.Spec.PID.SetpointRampRate = "fast"
+			},
+			fields: []string{"spec.pid.setpoint_weight_d", "spec.pid.setpoint_ramp_rate"},
+		},
+		{
+			name:   "Percentage deadband",
+			mutate: func(ps *PIDScaler) { ps.Spec.PID.Deadband = "5%" },
+		},
+		{
+			name:   "Malformed deadband",
+			mutate: func(ps *PIDScaler) { ps.Spec.PID.Deadband = "-5%" },
+			fields: []string{"spec.pid.deadband"},
+		},
+		{
+			name:   "Min greater than max",
+			mutate: func(ps *PIDScaler) { ps.Spec.Target.MinReplicas = 11 },
+			fields: []string{"spec.target.max_replicas"},
+		},
+		{
+			name: "Scaling behavior",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.Target.Behavior = &autoscalingv2.HorizontalPodAutoscalerBehavior{
+					ScaleDown: &autoscalingv2.HPAScalingRules{
+						StabilizationWindowSeconds: ptr.To(int32(600)),
+						Policies:                   []autoscalingv2.HPAScalingPolicy{{Type: autoscalingv2.PodsScalingPolicy, Value: 2, PeriodSeconds: 60}},
+					},
+				}
+			},
+		},
+		{
+			name: "Invalid scaling behavior",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.Target.Behavior = &autoscalingv2.HorizontalPodAutoscalerBehavior{
+					ScaleUp: &autoscalingv2.HPAScalingRules{
+						StabilizationWindowSeconds: ptr.To(int32(-1)),
+						SelectPolicy:               ptr.To(autoscalingv2.ScalingPolicySelect("Any")),
+					},
+					ScaleDown: &autoscalingv2.HPAScalingRules{
+						Policies: []autoscalingv2.HPAScalingPolicy{{Type: "Replicas", Value: 0, PeriodSeconds: 3600}},
+					},
+				}
+			},
+			fields: []string{
+				"spec.target.behavior.scaleUp.stabilizationWindowSeconds", "spec.target.behavior.scaleUp.selectPolicy",
+				"spec.target.behavior.scaleDown.policies[0].type", "spec.target.behavior.scaleDown.policies[0].value",
+				"spec.target.behavior.scaleDown.policies[0].periodSeconds",
+			},
+		},
+		{
+			name: "Non-positive interval and cooldown",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.Interval = 0
+				ps.Spec.CooldownTimeout = -1
+			},
+			fields: []string{"spec.interval", "spec.cooldown_timeout"},
+		},
+		{
+			name: "Unknown SASL mechanism",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.Kafka.UseSASL = true
+				ps.Spec.Kafka.SASLMechanism = "gssapi"
+			},
+			fields: []string{"spec.kafka.sasl_mechanism"},
+		},
+		{
+			name: "OAuth without token URL",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.Kafka.UseSASL = true
+				ps.Spec.Kafka.SASLMechanism = "oauthbearer"
+			},
+			fields: []string{"spec.kafka.oauth.tokenURL"},
+		},
+		{
+			name:   "Missing target",
+			mutate: func(ps *PIDScaler) { ps.Spec.Target.ScaleTargetRef = nil },
+			fields: []string{"spec.target.scaleTargetRef"},
+		},
+		{
+			name: "Deprecated deployment target",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.Target.ScaleTargetRef = nil
+				ps.Spec.Target.Deployment = "app"
+			},
+		},
+		{
+			name: "Empty brokers and no topics",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.Kafka.Brokers = nil
+				ps.Spec.Kafka.Topic = ""
+			},
+			fields: []string{"spec.kafka.brokers", "spec.kafka.topic"},
+		},
+		{
+			name:   "Missing Kafka settings",
+			mutate: func(ps *PIDScaler) { ps.Spec.Kafka = nil },
+			fields: []string{"spec.kafka"},
+		},
+		{
+			name: "Missing Prometheus settings",
+			mutate: func(ps *PIDScaler) {
+				ps.Spec.Source.Type = SourceTypePrometheus
+				ps.Spec.Kafka = nil
+			},
+			fields: []string{"spec.source.prometheus"},
+		},
+	}
+
+	validator := &PIDScalerValidator{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := validPIDScaler()
+			tt.mutate(ps)
+			_, err := validator.ValidateCreate(context.Background(), ps)
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			statusErr, ok := err.(*apierrors.StatusError)
+			if !ok || !apierrors.IsInvalid(err) {
+				t.Fatalf("expected an Invalid error, got %v", err)
+			}
+			causes := map[string]bool{}
+			for _, cause := range statusErr.ErrStatus.Details.Causes {
+				causes[cause.Field] = true
+			}
+			for _, field := range tt.fields {
+				if !causes[field] {
+					t.Errorf("expected an error for %s, got %v", field, err)
+				}
+			}
+			if len(causes) != len(tt.fields) {
+				t.Errorf("expected errors for %v, got %v", tt.fields, err)
+			}
+		})
+	}
+}
+
+func TestValidatePIDScalerWarnings(t *testing.T) {
+	ps := validPIDScaler()
+	ps.Spec.Target.Deployment = "app"
+	ps.Spec.Kafka.Username = "user"
+
+	warnings, err := (&PIDScalerValidator{}).ValidateUpdate(context.Background(), validPIDScaler(), ps)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("expected 2 warnings for deprecated fields, got %v", warnings)
+	}
+}
+
+func TestDefaultPIDScaler(t *testing.T) {
+	ps := &PIDScaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "apps"},
+		Spec: PIDScalerSpec{
+			Kafka: &KafkaSettings{
+				Brokers:              []string{"kafka:9092"},
+				Topic:                "orders",
+				Group:                "consumers",
+				CredentialsSecretRef: &CredentialsSecretRef{Name: "kafka"},
+				GroupStatePolicy:     &GroupStatePolicy{Empty: GroupStateActionSkip},
+			},
+			PID: PIDSettings{Kp: "0.1", Ki: "0.01", ReferenceSignal: 10},
+			Target: TargetSettings{
+				ScaleTargetRef: &autoscalingv2.CrossVersionObjectReference{Kind: "StatefulSet", Name: "app"},
+				MaxReplicas:    10,
+			},
+		},
+	}
+	if err := (&PIDScalerDefaulter{}).Default(context.Background(), ps); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if ps.Spec.Source.Type != SourceTypeKafka {
+		t.Errorf("Unexpected source type %q", ps.Spec.Source.Type)
+	}
+	if ps.Spec.Target.Namespace != "apps" {
+		t.Errorf("Target namespace should default to the PIDScaler namespace, got %q", ps.Spec.Target.Namespace)
+	}
+	if ps.Spec.Target.ScaleTargetRef.APIVersion != DefaultScaleTargetAPIVersion {
+		t.Errorf("Unexpected scale target API version %q", ps.Spec.Target.ScaleTargetRef.APIVersion)
+	}
+	if ps.Spec.PID.Kd != "0" {
+		t.Errorf("Kd should default to 0, got %q", ps.Spec.PID.Kd)
+	}
+	if ps.Spec.Interval != DefaultInterval || ps.Spec.CooldownTimeout != DefaultCooldownTimeout {
+		t.Errorf("Unexpected interval %d and cooldown %d", ps.Spec.Interval, ps.Spec.CooldownTimeout)
+	}
+	kafka := ps.Spec.Kafka
+	if kafka.Aggregation != DefaultAggregation || kafka.LagMode != DefaultLagMode {
+		t.Errorf("Unexpected aggregation %q and lag mode %q", kafka.Aggregation, kafka.LagMode)
+	}
+	if kafka.CredentialsSecretRef.UsernameKey != DefaultUsernameKey || kafka.CredentialsSecretRef.PasswordKey != DefaultPasswordKey {
+		t.Errorf("Unexpected credentials keys %+v", kafka.CredentialsSecretRef)
+	}
+	expectedPolicy := GroupStatePolicy{
+		Empty:               GroupStateActionSkip,
+		PreparingRebalance:  GroupStateActionCompute,
+		CompletingRebalance: GroupStateActionSkip,
+		Dead:                GroupStateActionError,
+	}
+	if *kafka.GroupStatePolicy != expectedPolicy {
+		t.Errorf("Unexpected group state policy %+v", *kafka.GroupStatePolicy)
+	}
+	if _, err := (&PIDScalerValidator{}).ValidateCreate(context.Background(), ps); err != nil {
+		t.Errorf("Defaulted spec should be valid, got %v", err)
+	}
+}
+
+func TestDefaultPIDScalerKeepsValues(t *testing.T) {
+	ps := validPIDScaler()
+	ps.Spec.PID.Kd = "0.5"
+	ps.Spec.Target.Namespace = "other"
+	ps.Spec.Interval = 3
+	ps.SetDefaults()
+
+	if ps.Spec.PID.Kd != "0.5" || ps.Spec.Target.Namespace != "other" || ps.Spec.Interval != 3 {
+		t.Errorf("Defaults should not override set values, got %+v", ps.Spec)
+	}
+}
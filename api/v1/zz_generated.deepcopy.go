@@ -21,9 +21,61 @@ limitations under the License.
 package v1
 
 import (
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsSecretRef) DeepCopyInto(out *CredentialsSecretRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsSecretRef.
+func (in *CredentialsSecretRef) DeepCopy() *CredentialsSecretRef {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsSecretRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupStatePolicy) DeepCopyInto(out *GroupStatePolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupStatePolicy.
+func (in *GroupStatePolicy) DeepCopy() *GroupStatePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupStatePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KafkaOAuthSettings) DeepCopyInto(out *KafkaOAuthSettings) {
+	*out = *in
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KafkaOAuthSettings.
+func (in *KafkaOAuthSettings) DeepCopy() *KafkaOAuthSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(KafkaOAuthSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KafkaSettings) DeepCopyInto(out *KafkaSettings) {
 	*out = *in
@@ -32,6 +84,31 @@ func (in *KafkaSettings) DeepCopyInto(out *KafkaSettings) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Topics != nil {
+		in, out := &in.Topics, &out.Topics
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(CredentialsSecretRef)
+		**out = **in
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(KafkaTLSSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OAuth != nil {
+		in, out := &in.OAuth, &out.OAuth
+		*out = new(KafkaOAuthSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GroupStatePolicy != nil {
+		in, out := &in.GroupStatePolicy, &out.GroupStatePolicy
+		*out = new(GroupStatePolicy)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KafkaSettings.
@@ -44,6 +121,36 @@ func (in *KafkaSettings) DeepCopy() *KafkaSettings {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KafkaTLSSettings) DeepCopyInto(out *KafkaTLSSettings) {
+	*out = *in
+	if in.CASecretRef != nil {
+		in, out := &in.CASecretRef, &out.CASecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.CertSecretRef != nil {
+		in, out := &in.CertSecretRef, &out.CertSecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.KeySecretRef != nil {
+		in, out := &in.KeySecretRef, &out.KeySecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KafkaTLSSettings.
+func (in *KafkaTLSSettings) DeepCopy() *KafkaTLSSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(KafkaTLSSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OperatorStatus) DeepCopyInto(out *OperatorStatus) {
 	*out = *in
@@ -87,6 +194,21 @@ func (in *PIDScaler) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PIDScalerDefaulter) DeepCopyInto(out *PIDScalerDefaulter) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PIDScalerDefaulter.
+func (in *PIDScalerDefaulter) DeepCopy() *PIDScalerDefaulter {
+	if in == nil {
+		return nil
+	}
+	out := new(PIDScalerDefaulter)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PIDScalerList) DeepCopyInto(out *PIDScalerList) {
 	*out = *in
@@ -122,7 +244,12 @@ func (in *PIDScalerList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PIDScalerSpec) DeepCopyInto(out *PIDScalerSpec) {
 	*out = *in
-	in.Kafka.DeepCopyInto(&out.Kafka)
+	in.Source.DeepCopyInto(&out.Source)
+	if in.Kafka != nil {
+		in, out := &in.Kafka, &out.Kafka
+		*out = new(KafkaSettings)
+		(*in).DeepCopyInto(*out)
+	}
 	out.PID = in.PID
 	in.Target.DeepCopyInto(&out.Target)
 }
@@ -141,6 +268,22 @@ func (in *PIDScalerSpec) DeepCopy() *PIDScalerSpec {
 func (in *PIDScalerStatus) DeepCopyInto(out *PIDScalerStatus) {
 	*out = *in
 	in.UpdateTime.DeepCopyInto(&out.UpdateTime)
+	if in.LastScaleTime != nil {
+		in, out := &in.LastScaleTime, &out.LastScaleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PIDState != nil {
+		in, out := &in.PIDState, &out.PIDState
+		*out = new(PIDStateSnapshot)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PIDScalerStatus.
@@ -153,6 +296,21 @@ func (in *PIDScalerStatus) DeepCopy() *PIDScalerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PIDScalerValidator) DeepCopyInto(out *PIDScalerValidator) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PIDScalerValidator.
+func (in *PIDScalerValidator) DeepCopy() *PIDScalerValidator {
+	if in == nil {
+		return nil
+	}
+	out := new(PIDScalerValidator)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PIDSettings) DeepCopyInto(out *PIDSettings) {
 	*out = *in
@@ -168,15 +326,89 @@ func (in *PIDSettings) DeepCopy() *PIDSettings {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PIDStateSnapshot) DeepCopyInto(out *PIDStateSnapshot) {
+	*out = *in
+	in.PrevTime.DeepCopyInto(&out.PrevTime)
+	if in.LastScale != nil {
+		in, out := &in.LastScale, &out.LastScale
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PIDStateSnapshot.
+func (in *PIDStateSnapshot) DeepCopy() *PIDStateSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(PIDStateSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusSettings) DeepCopyInto(out *PrometheusSettings) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusSettings.
+func (in *PrometheusSettings) DeepCopy() *PrometheusSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyRef) DeepCopyInto(out *SecretKeyRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyRef.
+func (in *SecretKeyRef) DeepCopy() *SecretKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceSettings) DeepCopyInto(out *SourceSettings) {
+	*out = *in
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(PrometheusSettings)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceSettings.
+func (in *SourceSettings) DeepCopy() *SourceSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetSettings) DeepCopyInto(out *TargetSettings) {
 	*out = *in
-	if in.DesiredReplicas != nil {
-		in, out := &in.DesiredReplicas, &out.DesiredReplicas
-		*out = new(int32)
+	if in.ScaleTargetRef != nil {
+		in, out := &in.ScaleTargetRef, &out.ScaleTargetRef
+		*out = new(v2.CrossVersionObjectReference)
 		**out = **in
 	}
-	in.UpdateTime.DeepCopyInto(&out.UpdateTime)
+	if in.Behavior != nil {
+		in, out := &in.Behavior, &out.Behavior
+		*out = new(v2.HorizontalPodAutoscalerBehavior)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetSettings.
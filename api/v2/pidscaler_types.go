@@ -0,0 +1,360 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Gain is a non-negative decimal number such as "0.001", kept as a string so that it survives
+// every client without float rounding
+// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+type Gain string
+
+// Decimal is a non-negative decimal number such as "2.5"
+// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+type Decimal string
+
+// SignedDecimal is a decimal number such as "-1.5"
+// +kubebuilder:validation:Pattern=`^-?[0-9]+(\.[0-9]+)?$`
+type SignedDecimal string
+
+type PrometheusSettings struct {
+	// Address of the Prometheus HTTP API, e.g. http://prometheus.monitoring:9090
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+	// Query must evaluate to a scalar or to a vector with exactly one series
+	// +kubebuilder:validation:MinLength=1
+	Query string `json:"query"`
+	// Timeout of a single query in seconds
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Timeout int32 `json:"timeout,omitempty"`
+}
+
+type SourceSettings struct {
+	// +kubebuilder:validation:Enum=kafka;prometheus
+	// +kubebuilder:default=kafka
+	Type string `json:"type"`
+	// Prometheus settings, required when type is prometheus
+	// +optional
+	Prometheus *PrometheusSettings `json:"prometheus,omitempty"`
+}
+
+// CredentialsSecretRef references a Secret in the PIDScaler namespace holding SASL credentials
+type CredentialsSecretRef struct {
+	Name string `json:"name"`
+	// +kubebuilder:default=username
+	// +optional
+	UsernameKey string `json:"usernameKey,omitempty"`
+	// +kubebuilder:default=password
+	// +optional
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// SecretKeyRef selects a key of a Secret in the PIDScaler namespace
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+type KafkaTLSSettings struct {
+	Enable bool `json:"enable"`
+	// CA bundle used to verify brokers, system roots are used when not set
+	// +optional
+	CASecretRef *SecretKeyRef `json:"caSecretRef,omitempty"`
+	// Client certificate for mTLS, requires KeySecretRef
+	// +optional
+	CertSecretRef *SecretKeyRef `json:"certSecretRef,omitempty"`
+	// Client private key for mTLS, requires CertSecretRef
+	// +optional
+	KeySecretRef *SecretKeyRef `json:"keySecretRef,omitempty"`
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// Overrides the server name used to verify broker certificates
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// KafkaOAuthSettings configures the oauthbearer mechanism, the client ID and secret are read from CredentialsSecretRef
+type KafkaOAuthSettings struct {
+	// Token endpoint of the identity provider used for the client credentials grant
+	TokenURL string `json:"tokenURL"`
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// GroupStatePolicy configures how lag is read while the consumer group is not Stable: Compute reads lag
+// from committed offsets, Skip skips the tick and Error reports a failure
+type GroupStatePolicy struct {
+	// Action while no consumer is running, defaults to Compute
+	// +kubebuilder:validation:Enum=Compute;Skip;Error
+	// +optional
+	Empty string `json:"empty,omitempty"`
+	// Action while the group waits for members to rejoin, defaults to Compute
+	// +kubebuilder:validation:Enum=Compute;Skip;Error
+	// +optional
+	PreparingRebalance string `json:"preparingRebalance,omitempty"`
+	// Action while partitions are being assigned, defaults to Skip
+	// +kubebuilder:validation:Enum=Compute;Skip;Error
+	// +optional
+	CompletingRebalance string `json:"completingRebalance,omitempty"`
+	// Action when the group has no members and no committed offsets, defaults to Error
+	// +kubebuilder:validation:Enum=Compute;Skip;Error
+	// +optional
+	Dead string `json:"dead,omitempty"`
+}
+
+// +kubebuilder:validation:XValidation:rule="!has(self.useSASL) || !self.useSASL || has(self.saslMechanism)",message="saslMechanism is required when useSASL is set"
+type KafkaSettings struct {
+	// +kubebuilder:validation:MinItems=1
+	Brokers []string `json:"brokers"`
+	// Single topic to track, it is combined with Topics and TopicPattern
+	// +optional
+	Topic string `json:"topic,omitempty"`
+	// +optional
+	Topics []string `json:"topics,omitempty"`
+	// Regular expression matched against the whole name of topics consumed by the group
+	// +optional
+	TopicPattern string `json:"topicPattern,omitempty"`
+	// How lag of the selected topics is combined into the controlled variable
+	// +kubebuilder:validation:Enum=sum;max;mean
+	// +kubebuilder:default=sum
+	// +optional
+	Aggregation string `json:"aggregation,omitempty"`
+	// Controlled variable: offsets (messages behind) or time (estimated seconds behind,
+	// derived from the lag and the observed produce rate of each topic)
+	// +kubebuilder:validation:Enum=offsets;time
+	// +kubebuilder:default=offsets
+	// +optional
+	LagMode string `json:"lagMode,omitempty"`
+	// +kubebuilder:validation:MinLength=1
+	Group string `json:"group"`
+	// +optional
+	UseSASL bool `json:"useSASL,omitempty"`
+	// +kubebuilder:validation:Enum=plain;scram_sha256;scram_sha512;oauthbearer
+	// +optional
+	SASLMechanism string `json:"saslMechanism,omitempty"`
+	// Deprecated: use CredentialsSecretRef, plain-text credentials are kept for PIDScalers written through v1
+	// +optional
+	Username string `json:"username,omitempty"`
+	// Deprecated: use CredentialsSecretRef
+	// +optional
+	Password string `json:"password,omitempty"`
+	// +optional
+	CredentialsSecretRef *CredentialsSecretRef `json:"credentialsSecretRef,omitempty"`
+	// +optional
+	TLS *KafkaTLSSettings `json:"tls,omitempty"`
+	// Settings of the oauthbearer SASL mechanism
+	// +optional
+	OAuth *KafkaOAuthSettings `json:"oauth,omitempty"`
+	// Clamp the desired replicas to the partition count of the selected topics
+	// +optional
+	CapToPartitions bool `json:"capToPartitions,omitempty"`
+	// Publish lag of every partition as the kafka_partition_lag metric
+	// +optional
+	PartitionLagMetrics bool `json:"partitionLagMetrics,omitempty"`
+	// +optional
+	GroupStatePolicy *GroupStatePolicy `json:"groupStatePolicy,omitempty"`
+}
+
+// +kubebuilder:validation:XValidation:rule="self.minReplicas <= self.maxReplicas",message="minReplicas must not be greater than maxReplicas"
+type TargetSettings struct {
+	// Resource scaled through its scale subresource, e.g. a Deployment, StatefulSet, Argo Rollout or any custom resource
+	ScaleTargetRef autoscalingv2.CrossVersionObjectReference `json:"scaleTargetRef"`
+	// Namespace of the target, defaults to the PIDScaler namespace
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	MinReplicas int32 `json:"minReplicas"`
+	// +kubebuilder:validation:Minimum=0
+	MaxReplicas int32 `json:"maxReplicas"`
+	// Scaling behavior of the HorizontalPodAutoscaler applied between the PID output and the scale of the target,
+	// the replica changes are not limited when it is not set
+	// +optional
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+type PIDSettings struct {
+	// Form of the controller: positional computes the replicas from the P, I and D terms, velocity adds the
+	// change of the terms to the current replicas of the target
+	// +kubebuilder:validation:Enum=positional;velocity
+	// +kubebuilder:default=positional
+	// +optional
+	Mode string `json:"mode,omitempty"`
+	Kp   Gain   `json:"kp"`
+	Ki   Gain   `json:"ki"`
+	// +kubebuilder:default="0"
+	// +optional
+	Kd              Gain  `json:"kd,omitempty"`
+	ReferenceSignal int64 `json:"referenceSignal"`
+	// Differentiate the error or the measured value, the latter avoids a derivative kick when referenceSignal changes
+	// +kubebuilder:validation:Enum=error;measurement
+	// +kubebuilder:default=error
+	// +optional
+	DerivativeOn string `json:"derivativeOn,omitempty"`
+	// Time constant in seconds of the low-pass filter of the derivative term
+	// +optional
+	DerivativeFilterTime Decimal `json:"derivativeFilterTime,omitempty"`
+	// Sets the time constant of the derivative filter to Kd/(Kp*N) when derivativeFilterTime is not set
+	// +optional
+	DerivativeFilterN Decimal `json:"derivativeFilterN,omitempty"`
+	// Anti-windup strategy: conditional stops integrating while the output is saturated, back_calculation
+	// unwinds the integral by trackingGain times the excess over the replica limits and clamp keeps the
+	// integral term between integralMin and integralMax
+	// +kubebuilder:validation:Enum=conditional;back_calculation;clamp
+	// +kubebuilder:default=conditional
+	// +optional
+	AntiWindup string `json:"antiWindup,omitempty"`
+	// Back-calculation tracking gain in 1/s, the integral tracks the replica limits within one interval when empty
+	// +optional
+	TrackingGain Decimal `json:"trackingGain,omitempty"`
+	// Lower limit of the integral term in replicas for the clamp strategy, defaults to minReplicas
+	// +optional
+	IntegralMin SignedDecimal `json:"integralMin,omitempty"`
+	// Upper limit of the integral term in replicas for the clamp strategy, defaults to maxReplicas
+	// +optional
+	IntegralMax SignedDecimal `json:"integralMax,omitempty"`
+	// Weight b of referenceSignal in the proportional term, values below 1 soften the response to changes of
+	// referenceSignal. Defaults to 1
+	// +optional
+	SetpointWeightP Decimal `json:"setpointWeightP,omitempty"`
+	// Weight c of referenceSignal in the derivative term when derivativeOn is error. Defaults to 1
+	// +optional
+	SetpointWeightD Decimal `json:"setpointWeightD,omitempty"`
+	// Maximum change of the effective reference signal per second, not limited when empty
+	// +optional
+	SetpointRampRate Decimal `json:"setpointRampRate,omitempty"`
+	// Width of the band around referenceSignal in which the replicas are held and the integral is frozen,
+	// either absolute like "50" or a percentage of referenceSignal like "5%". Disabled when empty
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?%?$`
+	// +optional
+	Deadband string `json:"deadband,omitempty"`
+}
+
+// PIDScalerSpec defines the desired state of PIDScaler
+type PIDScalerSpec struct {
+	// +optional
+	// +kubebuilder:default={type: kafka}
+	Source SourceSettings `json:"source,omitempty"`
+	// Kafka settings, required when source type is kafka
+	// +optional
+	Kafka  *KafkaSettings `json:"kafka,omitempty"`
+	PID    PIDSettings    `json:"pid"`
+	Target TargetSettings `json:"target"`
+	// Seconds between two reads of the metric source
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=15
+	// +optional
+	Interval int32 `json:"interval,omitempty"`
+	// Minimum seconds between two scaling actions
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=60
+	// +optional
+	CooldownTimeout int32 `json:"cooldownTimeout,omitempty"`
+}
+
+// PIDStateSnapshot is the state of the PID controller, a worker started after an operator restart or a leader
+// change continues from it unless it is stale
+type PIDStateSnapshot struct {
+	// Integral accumulator
+	Integral string `json:"integral"`
+	// Error of the last update
+	PrevError string `json:"prevError"`
+	// Measured value of the last update
+	// +optional
+	PrevMeasurement string `json:"prevMeasurement,omitempty"`
+	// Filtered derivative term of the last update
+	// +optional
+	Derivative string `json:"derivative,omitempty"`
+	// Output bias that holds the integral term while Ki is 0
+	// +optional
+	Bias string `json:"bias,omitempty"`
+	// Time of the last update
+	PrevTime metav1.MicroTime `json:"prevTime"`
+	// Start of the current cooldown period
+	// +optional
+	LastScale *metav1.Time `json:"lastScale,omitempty"`
+}
+
+// PIDScalerStatus defines the observed state of PIDScaler
+type PIDScalerStatus struct {
+	Status     string      `json:"status"`
+	Message    string      `json:"message,omitempty"`
+	UpdateTime metav1.Time `json:"updateTime,omitempty"`
+	// Last observed state of the Kafka consumer group
+	// +optional
+	GroupState string `json:"groupState,omitempty"`
+	// Generation of the spec the Ready condition refers to
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Last value read from the metric source
+	// +optional
+	LastMeasuredValue string `json:"lastMeasuredValue,omitempty"`
+	// Last PID controller output before rounding
+	// +optional
+	LastOutput string `json:"lastOutput,omitempty"`
+	// Number of replicas of the target as last observed
+	// +optional
+	CurrentReplicas int32 `json:"currentReplicas,omitempty"`
+	// Number of replicas last computed by the PID controller, the worker scales the target to it
+	// +optional
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+	// Last time the target was scaled
+	// +optional
+	LastScaleTime *metav1.Time `json:"lastScaleTime,omitempty"`
+	// State of the PID controller, written at every update
+	// +optional
+	PIDState *PIDStateSnapshot `json:"pidState,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Current",type=integer,JSONPath=`.status.currentReplicas`
+// +kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredReplicas`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PIDScaler is the Schema for the pidscalers API
+type PIDScaler struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PIDScalerSpec   `json:"spec,omitempty"`
+	Status PIDScalerStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PIDScalerList contains a list of PIDScaler
+type PIDScalerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PIDScaler `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PIDScaler{}, &PIDScalerList{})
+}
@@ -20,6 +20,7 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -27,7 +28,10 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/scale"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -36,6 +40,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+	pidscalerv2 "github.com/timson/pidhpa-operator/api/v2"
 	"github.com/timson/pidhpa-operator/internal/controller"
 	internalmetrics "github.com/timson/pidhpa-operator/internal/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -51,6 +56,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(pidscalerv1.AddToScheme(scheme))
+	utilruntime.Must(pidscalerv2.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -60,6 +66,7 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var pidStateStaleness time.Duration
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -71,6 +78,8 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.DurationVar(&pidStateStaleness, "pid-state-staleness", controller.DefaultPIDStateStaleness,
+		"Age after which the PID state persisted in PIDScaler status is discarded instead of restored on worker start")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -147,15 +156,40 @@ func main() {
 		os.Exit(1)
 	}
 
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create discovery client")
+		os.Exit(1)
+	}
+	scaleClient, err := scale.NewForConfig(mgr.GetConfig(), mgr.GetRESTMapper(), dynamic.LegacyAPIPathResolverFunc,
+		scale.NewDiscoveryScaleKindResolver(discoveryClient))
+	if err != nil {
+		setupLog.Error(err, "unable to create scale client")
+		os.Exit(1)
+	}
+
 	pidScalerReconciler := &controller.PIDScalerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		ScaleClient:       scaleClient,
+		PIDStateStaleness: pidStateStaleness,
 	}
 
 	if err = (pidScalerReconciler).SetupWithManager(ctx, mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PIDScaler")
 		os.Exit(1)
 	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&pidscalerv1.PIDScaler{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PIDScaler")
+			os.Exit(1)
+		}
+		if err = (&pidscalerv2.PIDScaler{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PIDScaler")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -168,6 +202,11 @@ func main() {
 	}
 	metrics.Registry.MustRegister(
 		internalmetrics.KafkaLag,
+		internalmetrics.KafkaLagSeconds,
+		internalmetrics.SourceValue,
+		internalmetrics.KafkaPartitionLag,
+		internalmetrics.KafkaPartitions,
+		internalmetrics.KafkaGroupState,
 		internalmetrics.ReferenceSignal,
 		internalmetrics.MinOutput,
 		internalmetrics.MaxOutput,
@@ -0,0 +1,247 @@
+package behavior
+
+import (
+	"math"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// Defaults of the HPA for the parts of a behavior that are not set
+const (
+	DefaultScaleUpStabilizationWindow   = 0
+	DefaultScaleDownStabilizationWindow = 300
+	DefaultPolicyPeriod                 = 15
+	DefaultScaleUpPods                  = 4
+	DefaultPercent                      = 100
+)
+
+type recommendation struct {
+	replicas int32
+	time     time.Time
+}
+
+type scaleEvent struct {
+	change int32
+	time   time.Time
+}
+
+// Limiter applies the scaling behavior of the HorizontalPodAutoscaler to the replicas recommended by the PID
+// controller. It keeps the recommendations and scale events needed to apply a scaling behavior. It is not safe for
+// concurrent use, every worker owns one
+type Limiter struct {
+	behavior        *autoscalingv2.HorizontalPodAutoscalerBehavior
+	recommendations []recommendation
+	scaleUpEvents   []scaleEvent
+	scaleDownEvents []scaleEvent
+}
+
+// NewLimiter creates a limiter for the behavior, a nil behavior doesn't limit the replica changes
+func NewLimiter(behavior *autoscalingv2.HorizontalPodAutoscalerBehavior) *Limiter {
+	return &Limiter{behavior: behavior}
+}
+
+// SetBehavior replaces the behavior, the recorded recommendations and scale events are kept
+func (l *Limiter) SetBehavior(behavior *autoscalingv2.HorizontalPodAutoscalerBehavior) {
+	l.behavior = behavior
+}
+
+// Limit records the desired replicas and returns the replicas the target may be scaled to from current: the
+// recommendation is stabilized over the windows first and then limited by the scaling policies
+func (l *Limiter) Limit(now time.Time, current, desired int32) int32 {
+	if l.behavior == nil {
+		return desired
+	}
+	up := ScaleUpRules(l.behavior.ScaleUp)
+	down := ScaleDownRules(l.behavior.ScaleDown)
+	replicas := l.stabilize(now, current, desired, up, down)
+	return l.limitRate(now, current, replicas, up, down)
+}
+
+// RecordScale records a scale of the target, the scaling policies limit the change within their periods
+func (l *Limiter) RecordScale(now time.Time, from, to int32) {
+	switch {
+	case to > from:
+		l.scaleUpEvents = append(pruneEvents(l.scaleUpEvents, now, longestPeriod(l.behavior, true)),
+			scaleEvent{change: to - from, time: now})
+	case to < from:
+		l.scaleDownEvents = append(pruneEvents(l.scaleDownEvents, now, longestPeriod(l.behavior, false)),
+			scaleEvent{change: from - to, time: now})
+	}
+}
+
+// stabilize holds a scale up at the lowest and a scale down at the highest recommendation within the windows
+func (l *Limiter) stabilize(now time.Time, current, desired int32, up, down *autoscalingv2.HPAScalingRules) int32 {
+	upWindow := time.Duration(*up.StabilizationWindowSeconds) * time.Second
+	downWindow := time.Duration(*down.StabilizationWindowSeconds) * time.Second
+	upRecommendation, downRecommendation := desired, desired
+	kept := l.recommendations[:0]
+	for _, rec := range l.recommendations {
+		if rec.time.After(now.Add(-upWindow)) {
+			upRecommendation = min(upRecommendation, rec.replicas)
+		}
+		if rec.time.After(now.Add(-downWindow)) {
+			downRecommendation = max(downRecommendation, rec.replicas)
+		}
+		if rec.time.After(now.Add(-max(upWindow, downWindow))) {
+			kept = append(kept, rec)
+		}
+	}
+	l.recommendations = append(kept, recommendation{replicas: desired, time: now})
+
+	replicas := current
+	if replicas < upRecommendation {
+		replicas = upRecommendation
+	}
+	if replicas > downRecommendation {
+		replicas = downRecommendation
+	}
+	return replicas
+}
+
+// limitRate limits the change from current to the replicas allowed by the scaling policies
+func (l *Limiter) limitRate(now time.Time, current, desired int32, up, down *autoscalingv2.HPAScalingRules) int32 {
+	if desired > current {
+		limit := max(l.scaleUpLimit(now, current, up), current)
+		return min(desired, limit)
+	}
+	if desired < current {
+		limit := min(l.scaleDownLimit(now, current, down), current)
+		return max(desired, limit)
+	}
+	return desired
+}
+
+func (l *Limiter) scaleUpLimit(now time.Time, current int32, rules *autoscalingv2.HPAScalingRules) int32 {
+	if *rules.SelectPolicy == autoscalingv2.DisabledPolicySelect {
+		return current
+	}
+	var result int32 = math.MinInt32
+	selectPolicy := maxReplicas
+	if *rules.SelectPolicy == autoscalingv2.MinChangePolicySelect {
+		result = math.MaxInt32
+		selectPolicy = minReplicas
+	}
+	for _, policy := range rules.Policies {
+		periodStart := current - changeInPeriod(l.scaleUpEvents, now, policy.PeriodSeconds) +
+			changeInPeriod(l.scaleDownEvents, now, policy.PeriodSeconds)
+		var proposed int32
+		switch policy.Type {
+		case autoscalingv2.PodsScalingPolicy:
+			proposed = periodStart + policy.Value
+		case autoscalingv2.PercentScalingPolicy:
+			proposed = int32(math.Ceil(float64(periodStart) * (1 + float64(policy.Value)/100)))
+		default:
+			continue
+		}
+		result = selectPolicy(result, proposed)
+	}
+	return result
+}
+
+func (l *Limiter) scaleDownLimit(now time.Time, current int32, rules *autoscalingv2.HPAScalingRules) int32 {
+	if *rules.SelectPolicy == autoscalingv2.DisabledPolicySelect {
+		return current
+	}
+	var result int32 = math.MaxInt32
+	selectPolicy := minReplicas
+	if *rules.SelectPolicy == autoscalingv2.MinChangePolicySelect {
+		result = math.MinInt32
+		selectPolicy = maxReplicas
+	}
+	for _, policy := range rules.Policies {
+		periodStart := current + changeInPeriod(l.scaleDownEvents, now, policy.PeriodSeconds) -
+			changeInPeriod(l.scaleUpEvents, now, policy.PeriodSeconds)
+		var proposed int32
+		switch policy.Type {
+		case autoscalingv2.PodsScalingPolicy:
+			proposed = periodStart - policy.Value
+		case autoscalingv2.PercentScalingPolicy:
+			proposed = int32(float64(periodStart) * (1 - float64(policy.Value)/100))
+		default:
+			continue
+		}
+		result = selectPolicy(result, proposed)
+	}
+	return result
+}
+
+func minReplicas(a, b int32) int32 { return min(a, b) }
+
+func maxReplicas(a, b int32) int32 { return max(a, b) }
+
+// changeInPeriod sums the replicas changed by the events within the last periodSeconds
+func changeInPeriod(events []scaleEvent, now time.Time, periodSeconds int32) int32 {
+	var change int32
+	start := now.Add(-time.Duration(periodSeconds) * time.Second)
+	for _, event := range events {
+		if event.time.After(start) {
+			change += event.change
+		}
+	}
+	return change
+}
+
+// pruneEvents drops the events older than the longest policy period
+func pruneEvents(events []scaleEvent, now time.Time, periodSeconds int32) []scaleEvent {
+	start := now.Add(-time.Duration(periodSeconds) * time.Second)
+	kept := events[:0]
+	for _, event := range events {
+		if event.time.After(start) {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
+
+func longestPeriod(behavior *autoscalingv2.HorizontalPodAutoscalerBehavior, scaleUp bool) int32 {
+	if behavior == nil {
+		return 0
+	}
+	rules := ScaleDownRules(behavior.ScaleDown)
+	if scaleUp {
+		rules = ScaleUpRules(behavior.ScaleUp)
+	}
+	var longest int32
+	for _, policy := range rules.Policies {
+		longest = max(longest, policy.PeriodSeconds)
+	}
+	return longest
+}
+
+// ScaleUpRules returns the scale up rules with the HPA defaults for the fields that are not set: no
+// stabilization, and the larger of 4 pods or 100% per 15 seconds
+func ScaleUpRules(rules *autoscalingv2.HPAScalingRules) *autoscalingv2.HPAScalingRules {
+	return withDefaults(rules, DefaultScaleUpStabilizationWindow, []autoscalingv2.HPAScalingPolicy{
+		{Type: autoscalingv2.PodsScalingPolicy, Value: DefaultScaleUpPods, PeriodSeconds: DefaultPolicyPeriod},
+		{Type: autoscalingv2.PercentScalingPolicy, Value: DefaultPercent, PeriodSeconds: DefaultPolicyPeriod},
+	})
+}
+
+// ScaleDownRules returns the scale down rules with the HPA defaults for the fields that are not set: a 300
+// seconds stabilization window and 100% per 15 seconds
+func ScaleDownRules(rules *autoscalingv2.HPAScalingRules) *autoscalingv2.HPAScalingRules {
+	return withDefaults(rules, DefaultScaleDownStabilizationWindow, []autoscalingv2.HPAScalingPolicy{
+		{Type: autoscalingv2.PercentScalingPolicy, Value: DefaultPercent, PeriodSeconds: DefaultPolicyPeriod},
+	})
+}
+
+func withDefaults(rules *autoscalingv2.HPAScalingRules, window int32,
+	policies []autoscalingv2.HPAScalingPolicy) *autoscalingv2.HPAScalingRules {
+	if rules == nil {
+		rules = &autoscalingv2.HPAScalingRules{}
+	} else {
+		rules = rules.DeepCopy()
+	}
+	if rules.StabilizationWindowSeconds == nil {
+		rules.StabilizationWindowSeconds = &window
+	}
+	if rules.SelectPolicy == nil {
+		selectPolicy := autoscalingv2.MaxChangePolicySelect
+		rules.SelectPolicy = &selectPolicy
+	}
+	if len(rules.Policies) == 0 {
+		rules.Policies = policies
+	}
+	return rules
+}
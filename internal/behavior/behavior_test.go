@@ -0,0 +1,99 @@
+package behavior
+
+import (
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/utils/ptr"
+)
+
+func TestLimiterWithoutBehavior(t *testing.T) {
+	limiter := NewLimiter(nil)
+	if replicas := limiter.Limit(time.Now(), 50, 2); replicas != 2 {
+		t.Errorf("Replicas should not be limited without a behavior. Got: %d", replicas)
+	}
+}
+
+func TestLimiterDefaults(t *testing.T) {
+	start := time.Now()
+	limiter := NewLimiter(&autoscalingv2.HorizontalPodAutoscalerBehavior{})
+
+	// the larger of 4 pods and 100% per 15 seconds
+	if replicas := limiter.Limit(start, 2, 20); replicas != 6 {
+		t.Errorf("Unexpected scale up from 2. Got: %d, expected 6", replicas)
+	}
+	if replicas := limiter.Limit(start, 10, 50); replicas != 20 {
+		t.Errorf("Unexpected scale up from 10. Got: %d, expected 20", replicas)
+	}
+
+	// the scale down is held at the highest recommendation of the last 300 seconds
+	if replicas := limiter.Limit(start.Add(time.Minute), 20, 5); replicas != 20 {
+		t.Errorf("Scale down should be stabilized. Got: %d, expected 20", replicas)
+	}
+	if replicas := limiter.Limit(start.Add(301*time.Second), 20, 5); replicas != 5 {
+		t.Errorf("Scale down should follow the recommendations after the window. Got: %d, expected 5", replicas)
+	}
+}
+
+func TestLimiterPolicies(t *testing.T) {
+	start := time.Now()
+	limiter := NewLimiter(&autoscalingv2.HorizontalPodAutoscalerBehavior{
+		ScaleUp: &autoscalingv2.HPAScalingRules{
+			Policies: []autoscalingv2.HPAScalingPolicy{
+				{Type: autoscalingv2.PodsScalingPolicy, Value: 2, PeriodSeconds: 60},
+			},
+		},
+		ScaleDown: &autoscalingv2.HPAScalingRules{
+			StabilizationWindowSeconds: ptr.To(int32(0)),
+			SelectPolicy:               ptr.To(autoscalingv2.MinChangePolicySelect),
+			Policies: []autoscalingv2.HPAScalingPolicy{
+				{Type: autoscalingv2.PercentScalingPolicy, Value: 50, PeriodSeconds: 60},
+				{Type: autoscalingv2.PodsScalingPolicy, Value: 5, PeriodSeconds: 60},
+			},
+		},
+	})
+
+	if replicas := limiter.Limit(start, 4, 10); replicas != 6 {
+		t.Errorf("Unexpected scale up. Got: %d, expected 6", replicas)
+	}
+	limiter.RecordScale(start, 4, 6)
+	if replicas := limiter.Limit(start.Add(30*time.Second), 6, 10); replicas != 6 {
+		t.Errorf("Scale up should be held within the period. Got: %d, expected 6", replicas)
+	}
+	if replicas := limiter.Limit(start.Add(61*time.Second), 6, 10); replicas != 8 {
+		t.Errorf("Scale up should continue after the period. Got: %d, expected 8", replicas)
+	}
+
+	// the smaller of 50% and 5 pods
+	if replicas := limiter.Limit(start.Add(2*time.Minute), 50, 2); replicas != 45 {
+		t.Errorf("Unexpected scale down. Got: %d, expected 45", replicas)
+	}
+	if replicas := limiter.Limit(start.Add(2*time.Minute), 6, 2); replicas != 3 {
+		t.Errorf("Unexpected scale down. Got: %d, expected 3", replicas)
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	limiter := NewLimiter(&autoscalingv2.HorizontalPodAutoscalerBehavior{
+		ScaleDown: &autoscalingv2.HPAScalingRules{
+			StabilizationWindowSeconds: ptr.To(int32(0)),
+			SelectPolicy:               ptr.To(autoscalingv2.DisabledPolicySelect),
+		},
+	})
+	if replicas := limiter.Limit(time.Now(), 10, 2); replicas != 10 {
+		t.Errorf("Scale down should be disabled. Got: %d, expected 10", replicas)
+	}
+}
+
+func TestLimiterScaleUpStabilization(t *testing.T) {
+	start := time.Now()
+	limiter := NewLimiter(&autoscalingv2.HorizontalPodAutoscalerBehavior{
+		ScaleUp: &autoscalingv2.HPAScalingRules{StabilizationWindowSeconds: ptr.To(int32(60))},
+	})
+	limiter.Limit(start, 4, 5)
+	// a spike is held at the lowest recommendation of the window
+	if replicas := limiter.Limit(start.Add(10*time.Second), 4, 8); replicas != 5 {
+		t.Errorf("Scale up should be stabilized. Got: %d, expected 5", replicas)
+	}
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+	"github.com/timson/pidhpa-operator/internal/pid"
+)
+
+// DefaultPIDStateStaleness is the age after which a persisted PID state is discarded instead of restored
+const DefaultPIDStateStaleness = 5 * time.Minute
+
+// pidStateSnapshot converts the state of a worker into its status representation
+func pidStateSnapshot(state pid.State, lastScale time.Time) *pidscalerv1.PIDStateSnapshot {
+	snapshot := &pidscalerv1.PIDStateSnapshot{
+		Integral:        strconv.FormatFloat(state.Integral, 'g', -1, 64),
+		PrevError:       strconv.FormatFloat(state.PrevError, 'g', -1, 64),
+		PrevMeasurement: strconv.FormatFloat(state.PrevMeasurement, 'g', -1, 64),
+		Derivative:      strconv.FormatFloat(state.Derivative, 'g', -1, 64),
+		Bias:            strconv.FormatFloat(state.Bias, 'g', -1, 64),
+		PrevTime:        metav1.NewMicroTime(state.PrevTime),
+	}
+	if !lastScale.IsZero() {
+		scaleTime := metav1.NewTime(lastScale)
+		snapshot.LastScale = &scaleTime
+	}
+	return snapshot
+}
+
+// restorePIDState parses a persisted state, it fails when the state is malformed or older than staleness. The
+// downtime counts as at most one interval, so the first update doesn't integrate and differentiate over all of it
+func restorePIDState(snapshot *pidscalerv1.PIDStateSnapshot, now time.Time, staleness time.Duration,
+	interval time.Duration) (pid.State, time.Time, error) {
+	var state pid.State
+	var lastScale time.Time
+	if snapshot.PrevTime.IsZero() {
+		return state, lastScale, fmt.Errorf("PID state has no update time")
+	}
+	if age := now.Sub(snapshot.PrevTime.Time); age > staleness {
+		return state, lastScale, fmt.Errorf("PID state is %s old, more than %s", age.Round(time.Second), staleness)
+	}
+	for _, value := range []struct {
+		name     string
+		value    string
+		optional bool
+		dst      *float64
+	}{
+		{"integral", snapshot.Integral, false, &state.Integral},
+		{"prevError", snapshot.PrevError, false, &state.PrevError},
+		{"prevMeasurement", snapshot.PrevMeasurement, true, &state.PrevMeasurement},
+		{"derivative", snapshot.Derivative, true, &state.Derivative},
+		{"bias", snapshot.Bias, true, &state.Bias},
+	} {
+		if value.optional && value.value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value.value, 64)
+		if err != nil {
+			return pid.State{}, lastScale, fmt.Errorf("invalid PID state %s: %w", value.name, err)
+		}
+		*value.dst = parsed
+	}
+	state.PrevTime = snapshot.PrevTime.Time
+	if earliest := now.Add(-interval); state.PrevTime.Before(earliest) {
+		state.PrevTime = earliest
+	}
+	if snapshot.LastScale != nil {
+		lastScale = snapshot.LastScale.Time
+	}
+	return state, lastScale, nil
+}
+
+// pidStateStaleness returns the configured staleness limit of persisted PID states
+func (r *PIDScalerReconciler) pidStateStaleness() time.Duration {
+	if r.PIDStateStaleness > 0 {
+		return r.PIDStateStaleness
+	}
+	return DefaultPIDStateStaleness
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/timson/pidhpa-operator/internal/pid"
+)
+
+var _ = Describe("PID state", func() {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := pid.State{
+		Integral:        12.5,
+		PrevError:       -0.1,
+		PrevMeasurement: 1234,
+		Derivative:      0.003,
+		Bias:            2,
+		PrevTime:        now.Add(-30 * time.Second),
+	}
+
+	It("should restore a persisted state", func() {
+		lastScale := now.Add(-time.Minute).Truncate(time.Second)
+		restored, restoredScale, err := restorePIDState(pidStateSnapshot(state, lastScale), now, time.Minute, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored.Integral).To(Equal(state.Integral))
+		Expect(restored.PrevError).To(Equal(state.PrevError))
+		Expect(restored.PrevMeasurement).To(Equal(state.PrevMeasurement))
+		Expect(restored.Derivative).To(Equal(state.Derivative))
+		Expect(restored.Bias).To(Equal(state.Bias))
+		Expect(restored.PrevTime.Equal(state.PrevTime)).To(BeTrue())
+		Expect(restoredScale.Equal(lastScale)).To(BeTrue())
+	})
+
+	It("should count the downtime as at most one interval", func() {
+		restored, _, err := restorePIDState(pidStateSnapshot(state, time.Time{}), now, time.Minute, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored.PrevTime.Equal(now.Add(-5 * time.Second))).To(BeTrue())
+	})
+
+	It("should not persist a cooldown that never started", func() {
+		Expect(pidStateSnapshot(state, time.Time{}).LastScale).To(BeNil())
+	})
+
+	It("should discard a stale state", func() {
+		_, _, err := restorePIDState(pidStateSnapshot(state, time.Time{}), now, 10*time.Second, time.Minute)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should discard a malformed state", func() {
+		snapshot := pidStateSnapshot(state, time.Time{})
+		snapshot.Integral = "NaN?"
+		_, _, err := restorePIDState(snapshot, now, time.Minute, time.Minute)
+		Expect(err).To(HaveOccurred())
+	})
+})
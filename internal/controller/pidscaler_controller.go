@@ -19,20 +19,28 @@ package controller
 import (
 	"context"
 	"sync"
+	"time"
 
+	"github.com/timson/pidhpa-operator/internal/source"
 	"github.com/timson/pidhpa-operator/internal/storage"
 
 	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
 	"github.com/timson/pidhpa-operator/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -40,14 +48,23 @@ import (
 // PIDScalerReconciler reconciles a PIDScaler object
 type PIDScalerReconciler struct {
 	client.Client
-	Scheme          *runtime.Scheme
-	Log             logr.Logger
-	Storage         *storage.PIDScalerStateStorage
-	OperatorContext context.Context
-	wg              *sync.WaitGroup
-	m               sync.Mutex
+	Scheme  *runtime.Scheme
+	Log     logr.Logger
+	Storage *storage.PIDScalerStateStorage
+	// SourceFactory creates metric sources for workers, newMetricSource is used when nil
+	SourceFactory func(*storage.PIDScalerState) (source.MetricSource, error)
+	// ScaleClient reads and updates the scale subresource of targets
+	ScaleClient scale.ScalesGetter
+	// PIDStateStaleness is the age after which the PID state persisted in status is discarded instead of
+	// restored, DefaultPIDStateStaleness is used when 0
+	PIDStateStaleness time.Duration
+	OperatorContext   context.Context
+	wg                *sync.WaitGroup
 }
 
+// FieldManager identifies the operator in managed fields of the objects it writes
+const FieldManager = "pidhpa-operator"
+
 func (r *PIDScalerReconciler) GetCRD(ctx context.Context, namespacedName client.ObjectKey) (pidscalerv1.PIDScaler, error) {
 	var pidScaler pidscalerv1.PIDScaler
 	err := r.Client.Get(ctx, namespacedName, &pidScaler)
@@ -57,43 +74,69 @@ func (r *PIDScalerReconciler) GetCRD(ctx context.Context, namespacedName client.
 	return pidScaler, err
 }
 
-func (r *PIDScalerReconciler) updateStatus(ctx context.Context, namespacedName client.ObjectKey, status string, message string) error {
-	r.m.Lock()
-	defer r.m.Unlock()
-
-	pidScaler, err := r.GetCRD(ctx, namespacedName)
-	if err != nil {
-		metrics.CRDFetchErrors.WithLabelValues(namespacedName.String()).Inc()
-		return err
-	}
-
-	pidScaler.Status = pidscalerv1.PIDScalerStatus{
-		Status:     status,
-		Message:    message,
-		UpdateTime: metav1.Now(),
-	}
-	if err = r.Update(ctx, &pidScaler); err != nil {
+// writeStatus applies mutate to the status of the latest PIDScaler and patches it through the status subresource,
+// nothing is written when mutate leaves the status unchanged. The patch is retried on conflicts since the
+// reconciler and the worker write the status concurrently.
+func (r *PIDScalerReconciler) writeStatus(ctx context.Context, namespacedName client.ObjectKey,
+	mutate func(status *pidscalerv1.PIDScalerStatus)) error {
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		pidScaler, err := r.GetCRD(ctx, namespacedName)
+		if err != nil {
+			return err
+		}
+		base := pidScaler.DeepCopy()
+		mutate(&pidScaler.Status)
+		if equality.Semantic.DeepEqual(base.Status, pidScaler.Status) {
+			return nil
+		}
+		// the optimistic lock keeps concurrent writers from dropping each other's conditions
+		return r.Status().Patch(ctx, &pidScaler, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}),
+			client.FieldOwner(FieldManager))
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
 		metrics.CRDUpdateErrors.WithLabelValues(namespacedName.String()).Inc()
-		return err
 	}
+	return err
+}
 
-	return nil
+// updateStatus records the reconcile outcome of the given generation in the status and the Ready condition
+func (r *PIDScalerReconciler) updateStatus(ctx context.Context, namespacedName client.ObjectKey, generation int64,
+	status string, reason string, message string) error {
+	return r.writeStatus(ctx, namespacedName, func(s *pidscalerv1.PIDScalerStatus) {
+		s.Status = status
+		s.Message = message
+		s.UpdateTime = metav1.Now()
+
+		ready := metav1.Condition{
+			Type:               pidscalerv1.ConditionReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: generation,
+		}
+		switch status {
+		case pidscalerv1.StatusInProgress:
+			// keep the outcome of the previous reconcile until this one completes
+			if meta.FindStatusCondition(s.Conditions, pidscalerv1.ConditionReady) != nil {
+				return
+			}
+			ready.Status = metav1.ConditionUnknown
+		case pidscalerv1.StatusDeployed:
+			ready.Status = metav1.ConditionTrue
+		case pidscalerv1.StatusUnknown:
+			ready.Status = metav1.ConditionUnknown
+		}
+		if status != pidscalerv1.StatusInProgress {
+			s.ObservedGeneration = generation
+		}
+		meta.SetStatusCondition(&s.Conditions, ready)
+	})
 }
 
-func (r *PIDScalerReconciler) updateDesiredReplicas(ctx context.Context, namespacedName client.ObjectKey, replicas int32) error {
-	r.m.Lock()
-	defer r.m.Unlock()
-	pidScaler, err := r.GetCRD(ctx, namespacedName)
-	if err != nil {
-		metrics.CRDFetchErrors.WithLabelValues(namespacedName.String()).Inc()
-		return err
-	}
-	pidScaler.Spec.Target.DesiredReplicas = &replicas
-	pidScaler.Spec.Target.UpdateTime = metav1.Now()
-	if err = r.Update(ctx, &pidScaler); err != nil {
-		metrics.CRDUpdateErrors.WithLabelValues(namespacedName.String()).Inc()
-	}
-	return err
+func (r *PIDScalerReconciler) updateGroupState(ctx context.Context, namespacedName client.ObjectKey, groupState string) error {
+	return r.writeStatus(ctx, namespacedName, func(s *pidscalerv1.PIDScalerStatus) {
+		s.GroupState = groupState
+	})
 }
 
 // +kubebuilder:rbac:groups=pidscaler.ts,resources=pidscalers,verbs=get;list;watch;create;update;patch;delete
@@ -108,43 +151,56 @@ func (r *PIDScalerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	pidScalerCRD, err := r.GetCRD(ctx, req.NamespacedName)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
+			// there is no status left to update once the resource is gone
 			r.Log.Info("PIDScaler CRD not found. Ignoring since it must be deleted.")
-			if err = r.updateStatus(ctx, req.NamespacedName, pidscalerv1.StatusTerminating, "Resource is being deleted"); err != nil {
-				return ctrl.Result{}, err
-			}
 			r.StopWorker(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		r.Log.Error(err, "Failed to get PIDScaler CRD")
-		if statusErr := r.updateStatus(ctx, req.NamespacedName, pidscalerv1.StatusUnknown, err.Error()); statusErr != nil {
+		if statusErr := r.updateStatus(ctx, req.NamespacedName, 0, pidscalerv1.StatusUnknown, pidscalerv1.ReasonFailedGetCRD, err.Error()); statusErr != nil {
 			return ctrl.Result{}, statusErr
 		}
 		return ctrl.Result{}, err
 	}
+	generation := pidScalerCRD.Generation
 
-	if err = r.updateStatus(ctx, req.NamespacedName, pidscalerv1.StatusInProgress, "Reconciliation in progress"); err != nil {
+	if err = r.updateStatus(ctx, req.NamespacedName, generation, pidscalerv1.StatusInProgress, pidscalerv1.ReasonReconciling,
+		"Reconciliation in progress"); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// the validating webhook may be disabled, so check the defaulted spec before running a worker for it
+	defaulted := pidScalerCRD.DeepCopy()
+	defaulted.SetDefaults()
+	if err = defaulted.Validate(); err != nil {
+		r.Log.Error(err, "Invalid PIDScaler spec")
+		r.StopWorker(req.NamespacedName)
+		// retrying won't help until the spec is fixed, so only report it in status
+		if statusErr := r.updateStatus(ctx, req.NamespacedName, generation, pidscalerv1.StatusFailed, pidscalerv1.ReasonInvalidSpec,
+			"Invalid spec: "+err.Error()); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+		return ctrl.Result{}, nil
+	}
+
 	pidScaler := storage.NewPIDScalerState(&pidScalerCRD)
+	if err = r.resolveKafkaSecrets(ctx, &pidScalerCRD, pidScaler); err != nil {
+		r.Log.Error(err, "Failed to resolve Kafka secrets")
+		if statusErr := r.updateStatus(ctx, req.NamespacedName, generation, pidscalerv1.StatusFailed, pidscalerv1.ReasonSecretError,
+			"Failed to resolve Kafka secrets: "+err.Error()); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+		return ctrl.Result{}, err
+	}
 
 	existingPIDScaler, exists := r.Storage.Get(req.NamespacedName.String())
 	if !exists {
-		r.StartWorker(r.OperatorContext, req.NamespacedName, pidScaler)
+		r.StartWorker(r.OperatorContext, req.NamespacedName, pidScaler, pidScalerCRD.Status.PIDState)
 	} else {
 		r.UpdateWorker(existingPIDScaler, pidScaler)
 	}
-	if pidScalerCRD.Spec.Target.DesiredReplicas != nil {
-		err = r.ScaleReplicas(ctx, pidScaler.TargetSettings.Namespace, pidScaler.TargetSettings.Deployment, *pidScalerCRD.Spec.Target.DesiredReplicas)
-		if err != nil {
-			r.Log.Error(err, "Failed to scale replicas")
-			if statusErr := r.updateStatus(ctx, req.NamespacedName, pidscalerv1.StatusFailed, "Failed to scale deployment: "+err.Error()); statusErr != nil {
-				return ctrl.Result{}, statusErr
-			}
-		}
-	}
-
-	if err = r.updateStatus(ctx, req.NamespacedName, pidscalerv1.StatusDeployed, "Reconciliation completed successfully"); err != nil {
+	if err = r.updateStatus(ctx, req.NamespacedName, generation, pidscalerv1.StatusDeployed, pidscalerv1.ReasonReconciled,
+		"Reconciliation completed successfully"); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -159,14 +215,15 @@ func (r *PIDScalerReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Man
 	r.OperatorContext = ctx
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&pidscalerv1.PIDScaler{}).
-		WithEventFilter(predicate.Funcs{
+		For(&pidscalerv1.PIDScaler{}, builder.WithPredicates(predicate.Funcs{
 			// Ignore updates that only change the status field
 			UpdateFunc: func(e event.UpdateEvent) bool {
 				oldObject := e.ObjectOld.(*pidscalerv1.PIDScaler)
 				newObject := e.ObjectNew.(*pidscalerv1.PIDScaler)
 				return !equality.Semantic.DeepEqual(oldObject.Spec, newObject.Spec)
 			},
-		}).
+		})).
+		// Re-resolve credentials when a Secret referenced by a PIDScaler changes
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.findPIDScalersForSecret)).
 		Complete(r)
 }
@@ -18,12 +18,16 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"github.com/timson/pidhpa-operator/internal/source"
 	"github.com/timson/pidhpa-operator/internal/storage"
 	"sync"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -31,8 +35,22 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+	pidscalerv2 "github.com/timson/pidhpa-operator/api/v2"
 )
 
+// fakeSource is a metric source that never reports a value, so workers don't try to scale
+type fakeSource struct{}
+
+func (f *fakeSource) Fetch(_ context.Context) (float64, error) {
+	return 0, fmt.Errorf("fake source")
+}
+
+func (f *fakeSource) Close() {}
+
+func (f *fakeSource) Describe() string {
+	return "fake"
+}
+
 var _ = Describe("PIDScaler Controller", func() {
 	Context("When reconciling a resource", func() {
 		const resourceName = "test-resource"
@@ -68,7 +86,7 @@ var _ = Describe("PIDScaler Controller", func() {
 							Kd:              "0.001",
 							ReferenceSignal: 100,
 						},
-						Kafka: pidscalerv1.KafkaSettings{
+						Kafka: &pidscalerv1.KafkaSettings{
 							Topic:   "test-topic",
 							Group:   "test-group",
 							Brokers: []string{"broker1:9092", "broker2:9092"},
@@ -104,14 +122,58 @@ var _ = Describe("PIDScaler Controller", func() {
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+
+			By("Reporting the Ready condition for the reconciled generation")
+			reconciled := &pidscalerv1.PIDScaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			Expect(reconciled.Status.ObservedGeneration).To(Equal(reconciled.Generation))
+			ready := meta.FindStatusCondition(reconciled.Status.Conditions, pidscalerv1.ConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Status).To(Equal(metav1.ConditionTrue))
+			Expect(ready.Reason).To(Equal(pidscalerv1.ReasonReconciled))
+		})
+		It("should merge concurrent status writes", func() {
+			attempts := 0
+			Expect(controllerReconciler.writeStatus(ctx, typeNamespacedName, func(s *pidscalerv1.PIDScalerStatus) {
+				attempts++
+				if attempts == 1 {
+					// another writer changes the status after this one read it, so its patch has a stale
+					// resourceVersion and conflicts
+					Expect(controllerReconciler.updateGroupState(ctx, typeNamespacedName, "Stable")).To(Succeed())
+				}
+				s.Status = pidscalerv1.StatusDeployed
+			})).To(Succeed())
+			Expect(attempts).To(Equal(2))
+
+			updated := &pidscalerv1.PIDScaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, updated)).To(Succeed())
+			Expect(updated.Status.GroupState).To(Equal("Stable"))
+			Expect(updated.Status.Status).To(Equal(pidscalerv1.StatusDeployed))
 		})
 		It("should handle missing PIDScaler resource", func() {
 			req := reconcile.Request{NamespacedName: typeNamespacedName}
 			_, err := controllerReconciler.Reconcile(ctx, req)
 			Expect(err).NotTo(HaveOccurred())
 		})
+		It("should not start a worker for an invalid spec", func() {
+			resource := &pidscalerv1.PIDScaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Interval = -1
+			resource.Spec.PID.Kp = "abc"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			_, found := controllerReconciler.Storage.Get(typeNamespacedName.String())
+			Expect(found).To(BeFalse())
+
+			rejected := &pidscalerv1.PIDScaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, rejected)).To(Succeed())
+			ready := meta.FindStatusCondition(rejected.Status.Conditions, pidscalerv1.ConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(pidscalerv1.ReasonInvalidSpec))
+		})
 		It("should validate the created PIDScaler resource", func() {
 			created := &pidscalerv1.PIDScaler{}
 			err := k8sClient.Get(ctx, typeNamespacedName, created)
@@ -119,5 +181,182 @@ var _ = Describe("PIDScaler Controller", func() {
 			Expect(created.Spec.Target.MinReplicas).To(Equal(int32(1)))
 			Expect(created.Spec.Target.MaxReplicas).To(Equal(int32(10)))
 		})
+		It("should serve the resource as v2 through the conversion webhook", func() {
+			converted := &pidscalerv2.PIDScaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, converted)).To(Succeed())
+			Expect(converted.Spec.PID.Kd).To(Equal(pidscalerv2.Gain("0.001")))
+			Expect(converted.Spec.Target.ScaleTargetRef.Kind).To(Equal(pidscalerv1.DefaultScaleTargetKind))
+			Expect(converted.Spec.Target.ScaleTargetRef.Name).To(Equal("test-deployment"))
+
+			By("keeping the deprecated v1 fields when read back as v1")
+			original := &pidscalerv1.PIDScaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, original)).To(Succeed())
+			Expect(original.Spec.Target.Deployment).To(Equal("test-deployment"))
+			Expect(original.Spec.Target.ScaleTargetRef).To(BeNil())
+		})
+	})
+
+	Context("When Kafka credentials are stored in a Secret", func() {
+		const resourceName = "test-resource-sasl"
+		const secretName = "kafka-credentials"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		var controllerReconciler *PIDScalerReconciler
+		var createdSources chan storage.PIDScalerState
+
+		BeforeEach(func() {
+			By("creating the credentials Secret")
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      secretName,
+					Namespace: "default",
+				},
+				Data: map[string][]byte{
+					"user":   []byte("consumer"),
+					"pass":   []byte("s3cr3t"),
+					"ca.crt": []byte("ca-v1"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+
+			By("creating the PIDScaler referencing the Secret")
+			resource := &pidscalerv1.PIDScaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: pidscalerv1.PIDScalerSpec{
+					Target: pidscalerv1.TargetSettings{
+						Deployment:  "test-deployment",
+						Namespace:   "default",
+						MinReplicas: 1,
+						MaxReplicas: 10,
+					},
+					PID: pidscalerv1.PIDSettings{
+						Kp:              "0.1",
+						Ki:              "0.01",
+						Kd:              "0",
+						ReferenceSignal: 100,
+					},
+					Kafka: &pidscalerv1.KafkaSettings{
+						Topic:         "test-topic",
+						Group:         "test-group",
+						Brokers:       []string{"broker1:9092"},
+						UseSASL:       true,
+						SASLMechanism: "scram_sha512",
+						CredentialsSecretRef: &pidscalerv1.CredentialsSecretRef{
+							Name:        secretName,
+							UsernameKey: "user",
+							PasswordKey: "pass",
+						},
+					},
+					CooldownTimeout: 60,
+					Interval:        1,
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			createdSources = make(chan storage.PIDScalerState, 1)
+			controllerReconciler = &PIDScalerReconciler{
+				Client:          k8sClient,
+				Scheme:          k8sClient.Scheme(),
+				Log:             zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)),
+				Storage:         storage.NewPIDScalerStorage(),
+				OperatorContext: ctx,
+				wg:              &sync.WaitGroup{},
+				SourceFactory: func(ps *storage.PIDScalerState) (source.MetricSource, error) {
+					select {
+					case createdSources <- *ps:
+					default:
+					}
+					return &fakeSource{}, nil
+				},
+			}
+		})
+
+		AfterEach(func() {
+			controllerReconciler.StopWorker(typeNamespacedName)
+			resource := &pidscalerv1.PIDScaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: secretName, Namespace: "default"}, secret)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+		})
+
+		It("should resolve credentials from the Secret", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			state, found := controllerReconciler.Storage.Get(typeNamespacedName.String())
+			Expect(found).To(BeTrue())
+			Expect(state.KafkaSettings.Username).To(Equal("consumer"))
+			Expect(state.KafkaSettings.Password).To(Equal("s3cr3t"))
+		})
+
+		It("should pass the authenticated config to the worker metric source", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			var state storage.PIDScalerState
+			Eventually(createdSources).Should(Receive(&state))
+			Expect(state.KafkaSettings.UseSASL).To(BeTrue())
+			Expect(state.KafkaSettings.SASLMechanism).To(Equal("scram_sha512"))
+			Expect(state.KafkaSettings.Username).To(Equal("consumer"))
+			Expect(state.KafkaSettings.Password).To(Equal("s3cr3t"))
+		})
+
+		It("should not start a worker for an unknown SASL mechanism", func() {
+			resource := &pidscalerv1.PIDScaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Kafka.SASLMechanism = "kerberos"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, found := controllerReconciler.Storage.Get(typeNamespacedName.String())
+			Expect(found).To(BeFalse())
+		})
+
+		It("should reload the Kafka TLS CA when the Secret rotates", func() {
+			resource := &pidscalerv1.PIDScaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Kafka.TLS = &pidscalerv1.KafkaTLSSettings{
+				Enable:      true,
+				CASecretRef: &pidscalerv1.SecretKeyRef{Name: secretName, Key: "ca.crt"},
+			}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			state, found := controllerReconciler.Storage.Get(typeNamespacedName.String())
+			Expect(found).To(BeTrue())
+			Expect(state.KafkaTLS.CA).To(Equal([]byte("ca-v1")))
+
+			By("rotating the CA in the Secret")
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: secretName, Namespace: "default"}, secret)).To(Succeed())
+			secret.Data["ca.crt"] = []byte("ca-v2")
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			state, found = controllerReconciler.Storage.Get(typeNamespacedName.String())
+			Expect(found).To(BeTrue())
+			Expect(state.KafkaTLS.CA).To(Equal([]byte("ca-v2")))
+		})
+
+		It("should map Secret events to the referencing PIDScaler", func() {
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: secretName, Namespace: "default"}, secret)).To(Succeed())
+			requests := controllerReconciler.findPIDScalersForSecret(ctx, secret)
+			Expect(requests).To(ConsistOf(reconcile.Request{NamespacedName: typeNamespacedName}))
+		})
 	})
 })
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// +kubebuilder:rbac:groups=*,resources=*/scale,verbs=get;update;patch
+
+// GetScale reads the scale subresource of the target, trying every resource the kind is mapped to
+func (r *PIDScalerReconciler) GetScale(ctx context.Context, namespace string,
+	ref autoscalingv2.CrossVersionObjectReference) (*autoscalingv1.Scale, schema.GroupResource, error) {
+	if r.ScaleClient == nil {
+		return nil, schema.GroupResource{}, fmt.Errorf("no scale client configured")
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, schema.GroupResource{}, fmt.Errorf("invalid scale target API version %q: %w", ref.APIVersion, err)
+	}
+	mappings, err := r.RESTMapper().RESTMappings(gv.WithKind(ref.Kind).GroupKind(), gv.Version)
+	if err != nil {
+		return nil, schema.GroupResource{}, fmt.Errorf("unable to map %s %s: %w", ref.APIVersion, ref.Kind, err)
+	}
+	for _, mapping := range mappings {
+		groupResource := mapping.Resource.GroupResource()
+		scale, scaleErr := r.ScaleClient.Scales(namespace).Get(ctx, groupResource, ref.Name, metav1.GetOptions{})
+		if scaleErr == nil {
+			return scale, groupResource, nil
+		}
+		err = scaleErr
+	}
+	return nil, schema.GroupResource{}, fmt.Errorf("unable to get scale of %s %s/%s: %w", ref.Kind, namespace, ref.Name, err)
+}
+
+// ScaleReplicas sets the replicas of the target through the scale subresource read by GetScale
+func (r *PIDScalerReconciler) ScaleReplicas(ctx context.Context, namespace string, groupResource schema.GroupResource,
+	scale *autoscalingv1.Scale, replicas int32) error {
+	if scale.Spec.Replicas == replicas {
+		return nil
+	}
+	scale = scale.DeepCopy()
+	scale.Spec.Replicas = replicas
+	_, err := r.ScaleClient.Scales(namespace).Update(ctx, groupResource, scale, metav1.UpdateOptions{})
+	if err != nil {
+		r.Log.Error(err, "Failed to scale target", "resource", groupResource.String(), "name", scale.Name,
+			"namespace", namespace, "replicas", replicas)
+		return err
+	}
+	r.Log.Info("Target scaled", "resource", groupResource.String(), "name", scale.Name, "namespace", namespace,
+		"replicas", replicas)
+	return nil
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/scale"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+)
+
+var _ = Describe("Scale target", func() {
+	const deploymentName = "scale-target"
+
+	ctx := context.Background()
+	var reconciler *PIDScalerReconciler
+
+	BeforeEach(func() {
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		scaleClient, err := scale.NewForConfig(cfg, k8sClient.RESTMapper(), dynamic.LegacyAPIPathResolverFunc,
+			scale.NewDiscoveryScaleKindResolver(discoveryClient))
+		Expect(err).NotTo(HaveOccurred())
+		reconciler = &PIDScalerReconciler{
+			Client:      k8sClient,
+			Scheme:      k8sClient.Scheme(),
+			Log:         zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)),
+			ScaleClient: scaleClient,
+		}
+
+		labels := map[string]string{"app": deploymentName}
+		Expect(k8sClient.Create(ctx, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: deploymentName, Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: ptr.To(int32(1)),
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "app", Image: "nginx"}},
+					},
+				},
+			},
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: deploymentName, Namespace: "default"},
+		})).To(Succeed())
+	})
+
+	It("should scale a target referenced by the deprecated deployment field", func() {
+		target := pidscalerv1.TargetSettings{Deployment: deploymentName}
+		targetScale, groupResource, err := reconciler.GetScale(ctx, "default", target.GetScaleTargetRef())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targetScale.Spec.Replicas).To(Equal(int32(1)))
+		Expect(groupResource.Resource).To(Equal("deployments"))
+
+		Expect(reconciler.ScaleReplicas(ctx, "default", groupResource, targetScale, 3)).To(Succeed())
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: deploymentName, Namespace: "default"}, deployment)).To(Succeed())
+		Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+	})
+
+	It("should resolve scaleTargetRef through the REST mapper", func() {
+		target := pidscalerv1.TargetSettings{ScaleTargetRef: &autoscalingv2.CrossVersionObjectReference{
+			Kind: "Deployment",
+			Name: deploymentName,
+		}}
+		_, groupResource, err := reconciler.GetScale(ctx, "default", target.GetScaleTargetRef())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(groupResource.Group).To(Equal("apps"))
+	})
+
+	It("should fail for kinds without a mapping", func() {
+		_, _, err := reconciler.GetScale(ctx, "default", autoscalingv2.CrossVersionObjectReference{
+			APIVersion: "example.com/v1",
+			Kind:       "Unknown",
+			Name:       deploymentName,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+	"github.com/timson/pidhpa-operator/internal/storage"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// getSecretValue returns a single key of a Secret
+func (r *PIDScalerReconciler) getSecretValue(ctx context.Context, namespace string, name string, key string) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+	value, found := secret.Data[key]
+	if !found {
+		return nil, fmt.Errorf("key %q not found in secret %s/%s", key, namespace, name)
+	}
+	return value, nil
+}
+
+// resolveKafkaSecrets fills the state with everything the PIDScaler reads from Secrets
+func (r *PIDScalerReconciler) resolveKafkaSecrets(ctx context.Context, pidScaler *pidscalerv1.PIDScaler, state *storage.PIDScalerState) error {
+	if err := r.resolveKafkaCredentials(ctx, pidScaler, state); err != nil {
+		return err
+	}
+	return r.resolveKafkaTLS(ctx, pidScaler, state)
+}
+
+// resolveKafkaCredentials fills SASL credentials of the state from the Secret referenced by the PIDScaler
+func (r *PIDScalerReconciler) resolveKafkaCredentials(ctx context.Context, pidScaler *pidscalerv1.PIDScaler, state *storage.PIDScalerState) error {
+	if pidScaler.Spec.Kafka == nil || pidScaler.Spec.Kafka.CredentialsSecretRef == nil {
+		return nil
+	}
+	ref := pidScaler.Spec.Kafka.CredentialsSecretRef
+	username, err := r.getSecretValue(ctx, pidScaler.Namespace, ref.Name, ref.GetUsernameKey())
+	if err != nil {
+		return err
+	}
+	password, err := r.getSecretValue(ctx, pidScaler.Namespace, ref.Name, ref.GetPasswordKey())
+	if err != nil {
+		return err
+	}
+	state.KafkaSettings.Username = string(username)
+	state.KafkaSettings.Password = string(password)
+	return nil
+}
+
+// resolveKafkaTLS fills TLS material of the state from the Secrets referenced by the PIDScaler
+func (r *PIDScalerReconciler) resolveKafkaTLS(ctx context.Context, pidScaler *pidscalerv1.PIDScaler, state *storage.PIDScalerState) error {
+	if pidScaler.Spec.Kafka == nil || pidScaler.Spec.Kafka.TLS == nil || !pidScaler.Spec.Kafka.TLS.Enable {
+		return nil
+	}
+	tlsSettings := pidScaler.Spec.Kafka.TLS
+	refs := []struct {
+		ref   *pidscalerv1.SecretKeyRef
+		value *[]byte
+	}{
+		{tlsSettings.CASecretRef, &state.KafkaTLS.CA},
+		{tlsSettings.CertSecretRef, &state.KafkaTLS.Cert},
+		{tlsSettings.KeySecretRef, &state.KafkaTLS.Key},
+	}
+	for _, item := range refs {
+		if item.ref == nil {
+			continue
+		}
+		value, err := r.getSecretValue(ctx, pidScaler.Namespace, item.ref.Name, item.ref.Key)
+		if err != nil {
+			return err
+		}
+		*item.value = value
+	}
+	return nil
+}
+
+// referencedSecrets returns names of the Secrets the PIDScaler depends on
+func referencedSecrets(pidScaler *pidscalerv1.PIDScaler) []string {
+	var names []string
+	if pidScaler.Spec.Kafka != nil && pidScaler.Spec.Kafka.CredentialsSecretRef != nil {
+		names = append(names, pidScaler.Spec.Kafka.CredentialsSecretRef.Name)
+	}
+	if pidScaler.Spec.Kafka != nil && pidScaler.Spec.Kafka.TLS != nil {
+		for _, ref := range []*pidscalerv1.SecretKeyRef{
+			pidScaler.Spec.Kafka.TLS.CASecretRef,
+			pidScaler.Spec.Kafka.TLS.CertSecretRef,
+			pidScaler.Spec.Kafka.TLS.KeySecretRef,
+		} {
+			if ref != nil {
+				names = append(names, ref.Name)
+			}
+		}
+	}
+	return names
+}
+
+// findPIDScalersForSecret maps a Secret event to reconcile requests of the PIDScalers referencing it
+func (r *PIDScalerReconciler) findPIDScalersForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	var pidScalers pidscalerv1.PIDScalerList
+	if err := r.List(ctx, &pidScalers, client.InNamespace(secret.GetNamespace())); err != nil {
+		r.Log.Error(err, "Failed to list PIDScalers for secret", "secret", client.ObjectKeyFromObject(secret).String())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range pidScalers.Items {
+		for _, name := range referencedSecrets(&pidScalers.Items[i]) {
+			if name == secret.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pidScalers.Items[i])})
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -3,13 +3,22 @@ package controller
 import (
 	"context"
 	"errors"
+	"fmt"
+	prometheusclient "github.com/prometheus/client_golang/prometheus"
+	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+	"github.com/timson/pidhpa-operator/internal/behavior"
 	"github.com/timson/pidhpa-operator/internal/kafka"
 	"github.com/timson/pidhpa-operator/internal/metrics"
 	"github.com/timson/pidhpa-operator/internal/pid"
+	"github.com/timson/pidhpa-operator/internal/prometheus"
+	"github.com/timson/pidhpa-operator/internal/source"
 	"github.com/timson/pidhpa-operator/internal/storage"
-	"github.com/twmb/franz-go/pkg/kadm"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"math"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,37 +26,362 @@ func (r *PIDScalerReconciler) WaitForAllWorkers() {
 	r.wg.Wait()
 }
 
-func (r *PIDScalerReconciler) StartWorker(ctx context.Context, namespacedName client.ObjectKey, pidScaler *storage.PIDScalerState) {
+// StartWorker runs a worker for the PIDScaler, it continues from the persisted PID state when it is not stale
+func (r *PIDScalerReconciler) StartWorker(ctx context.Context, namespacedName client.ObjectKey, pidScaler *storage.PIDScalerState,
+	pidState *pidscalerv1.PIDStateSnapshot) {
 	r.Storage.AddOrUpdate(namespacedName.String(), pidScaler)
 	r.wg.Add(1)
-	go r.Worker(ctx, namespacedName, pidScaler)
+	go r.Worker(ctx, namespacedName, pidScaler, pidState.DeepCopy())
 }
 
-func updateMetrics(nsName string, lag float64, output float64, ps *storage.PIDScalerState) {
-	metrics.KafkaLag.WithLabelValues(nsName, ps.KafkaSettings.Topic, ps.KafkaSettings.Group).Set(lag)
-	metrics.ReferenceSignal.WithLabelValues(nsName, ps.KafkaSettings.Topic,
+// newMetricSource creates the metric source selected by the PIDScaler source settings
+func newMetricSource(ps *storage.PIDScalerState) (source.MetricSource, error) {
+	switch ps.SourceSettings.GetType() {
+	case pidscalerv1.SourceTypeKafka:
+		cfg := kafka.ClientConfig{
+			Brokers:       ps.KafkaSettings.Brokers,
+			UseSASL:       ps.KafkaSettings.UseSASL,
+			SASLMechanism: ps.KafkaSettings.SASLMechanism,
+			Username:      ps.KafkaSettings.Username,
+			Password:      ps.KafkaSettings.Password,
+		}
+		if ps.KafkaSettings.OAuth != nil {
+			cfg.OAuthTokenURL = ps.KafkaSettings.OAuth.TokenURL
+			cfg.OAuthScopes = ps.KafkaSettings.OAuth.Scopes
+		}
+		if tlsSettings := ps.KafkaSettings.TLS; tlsSettings != nil && tlsSettings.Enable {
+			tlsConfig, err := kafka.NewTLSConfig(ps.KafkaTLS.CA, ps.KafkaTLS.Cert, ps.KafkaTLS.Key,
+				tlsSettings.InsecureSkipVerify, tlsSettings.ServerName)
+			if err != nil {
+				return nil, err
+			}
+			cfg.TLS = tlsConfig
+		}
+		topicPattern, err := kafka.CompileTopicPattern(ps.KafkaSettings.TopicPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic pattern: %w", err)
+		}
+		return kafka.NewSource(cfg, ps.KafkaSettings.Group, kafka.LagOptions{
+			Topics:           ps.KafkaSettings.GetTopics(),
+			TopicPattern:     topicPattern,
+			Aggregation:      ps.KafkaSettings.Aggregation,
+			Mode:             ps.KafkaSettings.LagMode,
+			GroupStatePolicy: kafkaGroupStatePolicy(ps.KafkaSettings.GroupStatePolicy),
+		})
+	case pidscalerv1.SourceTypePrometheus:
+		settings := ps.SourceSettings.Prometheus
+		if settings == nil {
+			return nil, errors.New("prometheus source selected but no prometheus settings provided")
+		}
+		return prometheus.NewSource(settings.Address, settings.Query, time.Duration(settings.Timeout)*time.Second)
+	default:
+		return nil, fmt.Errorf("unknown metric source type %q", ps.SourceSettings.Type)
+	}
+}
+
+// kafkaGroupStatePolicy overrides the default group state policy with the actions set in the spec
+func kafkaGroupStatePolicy(settings *pidscalerv1.GroupStatePolicy) kafka.GroupStatePolicy {
+	policy := kafka.DefaultGroupStatePolicy()
+	if settings == nil {
+		return policy
+	}
+	for state, action := range map[string]string{
+		kafka.GroupStateEmpty:               settings.Empty,
+		kafka.GroupStatePreparingRebalance:  settings.PreparingRebalance,
+		kafka.GroupStateCompletingRebalance: settings.CompletingRebalance,
+		kafka.GroupStateDead:                settings.Dead,
+	} {
+		if action != "" {
+			policy[state] = action
+		}
+	}
+	return policy
+}
+
+func (r *PIDScalerReconciler) newSource(ps *storage.PIDScalerState) (source.MetricSource, error) {
+	if r.SourceFactory != nil {
+		return r.SourceFactory(ps)
+	}
+	return newMetricSource(ps)
+}
+
+// kafkaTopicLabel returns the value of the topic metric label, describing all selected topics
+func kafkaTopicLabel(settings *pidscalerv1.KafkaSettings) string {
+	label := strings.Join(settings.GetTopics(), ",")
+	if settings.TopicPattern != "" {
+		if label != "" {
+			label += ","
+		}
+		label += settings.TopicPattern
+	}
+	return label
+}
+
+// effectiveMaxReplicas returns the upper output limit, clamped to the partition count when CapToPartitions is set
+func effectiveMaxReplicas(ps *storage.PIDScalerState, metricSource source.MetricSource) int32 {
+	maxReplicas := ps.TargetSettings.MaxReplicas
+	if !ps.KafkaSettings.CapToPartitions {
+		return maxReplicas
+	}
+	partitioned, ok := metricSource.(source.PartitionedSource)
+	if !ok {
+		return maxReplicas
+	}
+	if partitions := partitioned.Partitions(); partitions > 0 && partitions < maxReplicas {
+		maxReplicas = max(partitions, ps.TargetSettings.MinReplicas)
+	}
+	return maxReplicas
+}
+
+func updatePartitionMetrics(nsName string, ps *storage.PIDScalerState, metricSource source.MetricSource) {
+	partitioned, ok := metricSource.(source.PartitionedSource)
+	if !ok {
+		return
+	}
+	metrics.KafkaPartitions.WithLabelValues(nsName, ps.KafkaSettings.Group).Set(float64(partitioned.Partitions()))
+	// drop series of partitions that are no longer selected
+	metrics.KafkaPartitionLag.DeletePartialMatch(prometheusclient.Labels{"namespaced_name": nsName})
+	if !ps.KafkaSettings.PartitionLagMetrics {
+		return
+	}
+	for _, lag := range partitioned.PartitionLags() {
+		metrics.KafkaPartitionLag.WithLabelValues(nsName, lag.Topic, strconv.Itoa(int(lag.Partition)),
+			ps.KafkaSettings.Group).Set(float64(lag.Lag))
+	}
+}
+
+// deleteSourceMetrics drops the series of the metric source, when the source is replaced or the worker stops
+func deleteSourceMetrics(nsName string) {
+	metrics.SourceValue.DeletePartialMatch(prometheusclient.Labels{"namespaced_name": nsName})
+}
+
+func updateMetrics(nsName string, metricSource source.MetricSource, value float64, output float64, ps *storage.PIDScalerState) {
+	topicLabel := kafkaTopicLabel(&ps.KafkaSettings)
+	metrics.SourceValue.WithLabelValues(nsName, ps.SourceSettings.GetType()).Set(value)
+	updatePartitionMetrics(nsName, ps, metricSource)
+	if ps.SourceSettings.GetType() == pidscalerv1.SourceTypeKafka {
+		// the time lag is published separately, so kafka_lag always counts messages; the series of the other
+		// lag mode are dropped when the mode changes
+		if ps.KafkaSettings.LagMode == kafka.LagModeTime {
+			metrics.KafkaLag.DeletePartialMatch(prometheusclient.Labels{"namespaced_name": nsName})
+			metrics.KafkaLagSeconds.WithLabelValues(nsName, topicLabel, ps.KafkaSettings.Group).Set(value)
+		} else {
+			metrics.KafkaLagSeconds.DeletePartialMatch(prometheusclient.Labels{"namespaced_name": nsName})
+			metrics.KafkaLag.WithLabelValues(nsName, topicLabel, ps.KafkaSettings.Group).Set(value)
+		}
+	}
+	metrics.ReferenceSignal.WithLabelValues(nsName, topicLabel,
 		ps.KafkaSettings.Group).Set(float64(ps.PidSettings.ReferenceSignal))
 	metrics.MinOutput.WithLabelValues(nsName, ps.TargetSettings.Namespace,
-		ps.TargetSettings.Deployment).Set(float64(ps.TargetSettings.MinReplicas))
+		ps.TargetSettings.GetScaleTargetRef().Name).Set(float64(ps.TargetSettings.MinReplicas))
 	metrics.MaxOutput.WithLabelValues(nsName, ps.TargetSettings.Namespace,
-		ps.TargetSettings.Deployment).Set(float64(ps.TargetSettings.MaxReplicas))
+		ps.TargetSettings.GetScaleTargetRef().Name).Set(float64(effectiveMaxReplicas(ps, metricSource)))
 	metrics.PidKp.WithLabelValues(nsName).Set(ps.PidSettings.GetKp())
 	metrics.PidKi.WithLabelValues(nsName).Set(ps.PidSettings.GetKi())
 	metrics.PidKd.WithLabelValues(nsName).Set(ps.PidSettings.GetKd())
 	metrics.PidOutput.WithLabelValues(nsName, ps.TargetSettings.Namespace,
-		ps.TargetSettings.Deployment).Set(output)
+		ps.TargetSettings.GetScaleTargetRef().Name).Set(output)
+}
+
+// updateSourceState publishes the consumer state reported by the source and records changes in status,
+// it returns the state that was successfully recorded
+func (r *PIDScalerReconciler) updateSourceState(ctx context.Context, namespacedName client.ObjectKey, ps *storage.PIDScalerState,
+	metricSource source.MetricSource, lastState string) string {
+	reporter, ok := metricSource.(source.StateReporter)
+	if !ok {
+		return lastState
+	}
+	state := reporter.State()
+	if state == "" || state == lastState {
+		return lastState
+	}
+	nsName := namespacedName.String()
+	metrics.KafkaGroupState.DeletePartialMatch(prometheusclient.Labels{"namespaced_name": nsName})
+	for _, known := range kafka.GroupStates {
+		metrics.KafkaGroupState.WithLabelValues(nsName, ps.KafkaSettings.Group, known).Set(0)
+	}
+	metrics.KafkaGroupState.WithLabelValues(nsName, ps.KafkaSettings.Group, state).Set(1)
+
+	r.Log.Info("Consumer group state changed", "name", nsName, "from", lastState, "to", state)
+	if err := r.updateGroupState(ctx, namespacedName, state); err != nil {
+		r.Log.Error(err, "Failed to update PIDScaler group state", "name", nsName)
+		// retry on the next tick
+		return lastState
+	}
+	return state
 }
 
-func (r *PIDScalerReconciler) Worker(ctx context.Context, namespacedName client.ObjectKey, initialPIDScaler *storage.PIDScalerState) {
+// scalingLimitedCondition reports whether the desired replica count is held at the min or max replicas or by the
+// scaling behavior, recommendedReplicas is the rounded PID output and desiredReplicas the count the behavior allows.
+// maxReplicas is the effective upper limit which may be lowered to the partition count
+func scalingLimitedCondition(ps *storage.PIDScalerState, recommendedReplicas, desiredReplicas int32, maxReplicas int32) metav1.Condition {
+	condition := metav1.Condition{
+		Type:    pidscalerv1.ConditionScalingLimited,
+		Status:  metav1.ConditionTrue,
+		Reason:  pidscalerv1.ReasonDesiredWithinRange,
+		Message: "the desired replica count is within the acceptable range",
+	}
+	switch {
+	case desiredReplicas < recommendedReplicas:
+		condition.Reason = pidscalerv1.ReasonScaleUpLimit
+		condition.Message = fmt.Sprintf("the scaling behavior holds the desired replica count at %d instead of %d",
+			desiredReplicas, recommendedReplicas)
+	case desiredReplicas > recommendedReplicas:
+		condition.Reason = pidscalerv1.ReasonScaleDownLimit
+		condition.Message = fmt.Sprintf("the scaling behavior holds the desired replica count at %d instead of %d",
+			desiredReplicas, recommendedReplicas)
+	case desiredReplicas >= maxReplicas && maxReplicas < ps.TargetSettings.MaxReplicas:
+		condition.Reason = pidscalerv1.ReasonCappedToPartitions
+		condition.Message = fmt.Sprintf("the desired replica count is capped to %d partitions", maxReplicas)
+	case desiredReplicas >= maxReplicas:
+		condition.Reason = pidscalerv1.ReasonTooManyReplicas
+		condition.Message = fmt.Sprintf("the desired replica count is held at the maximum of %d", maxReplicas)
+	case desiredReplicas <= ps.TargetSettings.MinReplicas:
+		condition.Reason = pidscalerv1.ReasonTooFewReplicas
+		condition.Message = fmt.Sprintf("the desired replica count is held at the minimum of %d", ps.TargetSettings.MinReplicas)
+	default:
+		condition.Status = metav1.ConditionFalse
+	}
+	return condition
+}
+
+// recordMetricError reports a failed read of the metric source in the status conditions
+func (r *PIDScalerReconciler) recordMetricError(ctx context.Context, namespacedName client.ObjectKey, fetchErr error) {
+	reason := pidscalerv1.ReasonFailedGetMetric
+	if errors.Is(fetchErr, kafka.ErrConsumerGroupNotStable) || errors.Is(fetchErr, source.ErrNotReady) {
+		reason = pidscalerv1.ReasonMetricNotReady
+	}
+	err := r.writeStatus(ctx, namespacedName, func(s *pidscalerv1.PIDScalerStatus) {
+		meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+			Type:    pidscalerv1.ConditionMetricAvailable,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: fetchErr.Error(),
+		})
+		meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+			Type:    pidscalerv1.ConditionScalingActive,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: "the desired replica count cannot be computed without a metric value",
+		})
+	})
+	if err != nil {
+		r.Log.Error(err, "Failed to update PIDScaler status", "name", namespacedName.String())
+	}
+}
+
+// tickStatus is the outcome of a worker tick with a metric value
+type tickStatus struct {
+	value               float64
+	output              float64
+	recommendedReplicas int32
+	desiredReplicas     int32
+	maxReplicas         int32
+	currentReplicas     *int32
+	targetErr           error
+	scaleErr            error
+	scaleTime           *metav1.Time
+	pidState            *pidscalerv1.PIDStateSnapshot
+}
+
+// recordTick reports the measured value, PID output and replica counts of a tick in the status
+func (r *PIDScalerReconciler) recordTick(ctx context.Context, namespacedName client.ObjectKey, ps *storage.PIDScalerState, tick tickStatus) {
+	err := r.writeStatus(ctx, namespacedName, func(s *pidscalerv1.PIDScalerStatus) {
+		s.LastMeasuredValue = strconv.FormatFloat(tick.value, 'f', -1, 64)
+		s.LastOutput = strconv.FormatFloat(tick.output, 'f', 3, 64)
+		s.DesiredReplicas = tick.desiredReplicas
+		if tick.currentReplicas != nil {
+			s.CurrentReplicas = *tick.currentReplicas
+		}
+		if tick.scaleTime != nil {
+			s.LastScaleTime = tick.scaleTime
+		}
+		s.PIDState = tick.pidState
+		meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+			Type:    pidscalerv1.ConditionMetricAvailable,
+			Status:  metav1.ConditionTrue,
+			Reason:  pidscalerv1.ReasonValidMetricFound,
+			Message: "the metric source returned a value",
+		})
+		active := metav1.Condition{
+			Type:    pidscalerv1.ConditionScalingActive,
+			Status:  metav1.ConditionTrue,
+			Reason:  pidscalerv1.ReasonValidMetricFound,
+			Message: "the PID controller is able to compute the desired replica count",
+		}
+		if tick.targetErr != nil {
+			active.Status = metav1.ConditionFalse
+			active.Reason = pidscalerv1.ReasonFailedGetTarget
+			active.Message = tick.targetErr.Error()
+		} else if tick.scaleErr != nil {
+			active.Status = metav1.ConditionFalse
+			active.Reason = pidscalerv1.ReasonFailedScale
+			active.Message = tick.scaleErr.Error()
+		}
+		meta.SetStatusCondition(&s.Conditions, active)
+		meta.SetStatusCondition(&s.Conditions, scalingLimitedCondition(ps, tick.recommendedReplicas, tick.desiredReplicas,
+			tick.maxReplicas))
+	})
+	if err != nil {
+		r.Log.Error(err, "Failed to update PIDScaler status", "name", namespacedName.String())
+	}
+}
+
+// configurePID applies the PID settings and the replica limits of the spec to the controller
+func configurePID(pidController *pid.PID, pidScaler *storage.PIDScalerState) {
+	settings := &pidScaler.PidSettings
+	pidController.UpdateConfig(settings.GetKp(), settings.GetKi(), settings.GetKd(),
+		float64(pidScaler.TargetSettings.MinReplicas), float64(pidScaler.TargetSettings.MaxReplicas), true)
+	pidController.SetDerivative(settings.DerivativeOn == pidscalerv1.DerivativeOnMeasurement,
+		settings.GetDerivativeFilterTime(), settings.GetDerivativeFilterN())
+	mode := pid.Positional
+	if settings.Mode == pidscalerv1.PIDModeVelocity {
+		mode = pid.Velocity
+	}
+	pidController.SetMode(mode)
+	pidController.SetSetpoint(settings.GetSetpointWeightP(), settings.GetSetpointWeightD(), settings.GetSetpointRampRate())
+	pidController.SetDeadband(settings.GetDeadband())
+	pidController.SetAntiWindup(antiWindupStrategy(settings.AntiWindup), settings.GetTrackingGain(),
+		settings.GetIntegralMin(), settings.GetIntegralMax())
+}
+
+// antiWindupStrategy maps the anti_windup field to the PID strategy, defaulting to conditional integration
+func antiWindupStrategy(antiWindup string) pid.AntiWindup {
+	switch antiWindup {
+	case pidscalerv1.AntiWindupBackCalculation:
+		return pid.BackCalculation
+	case pidscalerv1.AntiWindupClamp:
+		return pid.IntegralClamp
+	default:
+		return pid.ConditionalIntegration
+	}
+}
+
+func (r *PIDScalerReconciler) Worker(ctx context.Context, namespacedName client.ObjectKey, initialPIDScaler *storage.PIDScalerState,
+	pidState *pidscalerv1.PIDStateSnapshot) {
 	var lastScale time.Time
 	var pidScaler *storage.PIDScalerState
-	var kafkaAdminClient *kadm.Client
+	var metricSource source.MetricSource
 	var pidController *pid.PID
+	var limiter *behavior.Limiter
+	var sourceState string
+	var seeded bool
+	// replicas the target was last seen with or scaled to by the worker, -1 when unknown
+	knownReplicas := int32(-1)
 	var err error
 	pidScaler = initialPIDScaler
+	// the target the controller is seeded from, other target settings keep the accumulated state
+	seededTarget := pidScaler.TargetSettings.GetScaleTargetRef()
+	seededNamespace := pidScaler.TargetSettings.Namespace
 
 	r.Log.Info("Start worker", "name", namespacedName.String())
 	defer r.wg.Done()
+	defer func() {
+		if metricSource != nil {
+			metricSource.Close()
+		}
+		deleteSourceMetrics(namespacedName.String())
+	}()
 
 	for {
 		select {
@@ -66,72 +400,135 @@ func (r *PIDScalerReconciler) Worker(ctx context.Context, namespacedName client.
 				r.Log.Error(errors.New("PIDScaler not found"), "Weird case, pidScaler not found after update event received", "name", namespacedName.String())
 				return
 			}
-			// check if we need to reset PID controller and Kafka client
+			// check if we need to reset PID controller and metric source
 			if (changes&storage.PidSettingsMask != 0 || changes&storage.TargetSettingsMask != 0) && pidController != nil {
 				r.Log.Info("Updating PID controller", "name", namespacedName.String(), "Kp", pidScaler.PidSettings.GetKp(), "Ki",
 					pidScaler.PidSettings.GetKi(), "Kd", pidScaler.PidSettings.GetKd(), "minReplicas", pidScaler.TargetSettings.MinReplicas,
 					"maxReplicas", pidScaler.TargetSettings.MaxReplicas)
-				pidController.UpdateConfig(
-					pidScaler.PidSettings.GetKp(), pidScaler.PidSettings.GetKi(), pidScaler.PidSettings.GetKd(),
-					float64(pidScaler.TargetSettings.MinReplicas), float64(pidScaler.TargetSettings.MaxReplicas), true)
+				configurePID(pidController, pidScaler)
+			}
+			if changes&storage.TargetSettingsMask != 0 {
+				if limiter != nil {
+					limiter.SetBehavior(pidScaler.TargetSettings.Behavior)
+				}
+				target := pidScaler.TargetSettings.GetScaleTargetRef()
+				if target != seededTarget || pidScaler.TargetSettings.Namespace != seededNamespace {
+					// a different target runs other replicas, start over from them
+					seededTarget, seededNamespace = target, pidScaler.TargetSettings.Namespace
+					seeded = false
+					knownReplicas = -1
+					if limiter != nil {
+						limiter = behavior.NewLimiter(pidScaler.TargetSettings.Behavior)
+					}
+				}
 			}
-			if changes&storage.KafkaSettingsMask != 0 {
-				r.Log.Info("Updating Kafka client", "name", namespacedName.String(), "brokers", pidScaler.KafkaSettings.Brokers, "topic", pidScaler.KafkaSettings.Topic,
-					"group", pidScaler.KafkaSettings.Group)
-				kafkaAdminClient = nil
+			if changes&(storage.KafkaSettingsMask|storage.SourceSettingsMask) != 0 && metricSource != nil {
+				r.Log.Info("Updating metric source", "name", namespacedName.String(), "source", metricSource.Describe())
+				metricSource.Close()
+				metricSource = nil
+				sourceState = ""
+				deleteSourceMetrics(namespacedName.String())
 			}
 		default:
 			if pidController == nil {
-				pidController = pid.NewPID(
-					pidScaler.PidSettings.GetKp(), pidScaler.PidSettings.GetKi(), pidScaler.PidSettings.GetKd(),
-					float64(pidScaler.TargetSettings.MinReplicas), float64(pidScaler.TargetSettings.MaxReplicas), true)
+				pidController = &pid.PID{}
+				configurePID(pidController, pidScaler)
+				limiter = behavior.NewLimiter(pidScaler.TargetSettings.Behavior)
+				if pidState != nil {
+					state, scaleTime, err := restorePIDState(pidState, time.Now(), r.pidStateStaleness(),
+						time.Duration(pidScaler.Interval)*time.Second)
+					if err != nil {
+						r.Log.Info("Discarding persisted PID state", "name", namespacedName.String(), "reason", err.Error())
+					} else {
+						r.Log.Info("Restoring persisted PID state", "name", namespacedName.String(), "updated", pidState.PrevTime.Time)
+						pidController.Restore(state)
+						lastScale = scaleTime
+						seeded = true
+					}
+					pidState = nil
+				}
 			}
 
-			if kafkaAdminClient == nil {
-				kafkaAdminClient, err = kafka.NewKafkaClient(
-					pidScaler.KafkaSettings.Brokers,
-					pidScaler.KafkaSettings.UseSASL,
-					pidScaler.KafkaSettings.SASLMechanism,
-					pidScaler.KafkaSettings.Username,
-					pidScaler.KafkaSettings.Password,
-				)
+			if metricSource == nil {
+				metricSource, err = r.newSource(pidScaler)
 				if err != nil {
-					r.Log.Error(err, "Failed to create Kafka client")
+					r.Log.Error(err, "Failed to create metric source", "name", namespacedName.String())
 					time.Sleep(time.Duration(pidScaler.Interval) * time.Second)
 					continue
 				}
 			}
 
-			lag, err := kafka.GetKafkaLag(ctx, kafkaAdminClient, pidScaler.KafkaSettings.Group, pidScaler.KafkaSettings.Topic)
+			value, err := metricSource.Fetch(ctx)
+			sourceState = r.updateSourceState(ctx, namespacedName, pidScaler, metricSource, sourceState)
 			if err != nil {
-				if !errors.Is(err, kafka.ErrConsumerGroupNotStable) {
-					r.Log.Error(err, "Failed to read Kafka lag", "name", namespacedName.String())
+				if !errors.Is(err, kafka.ErrConsumerGroupNotStable) && !errors.Is(err, source.ErrNotReady) {
+					r.Log.Error(err, "Failed to read metric", "name", namespacedName.String(), "source", metricSource.Describe())
 				}
+				r.recordMetricError(ctx, namespacedName, err)
 			} else {
 				now := time.Now()
-				output := pidController.Update(float64(pidScaler.PidSettings.ReferenceSignal), float64(lag), now)
+				tick := tickStatus{value: value}
+				velocity := pidScaler.PidSettings.Mode == pidscalerv1.PIDModeVelocity
+				scaleTarget := pidScaler.TargetSettings.GetScaleTargetRef()
+				targetScale, groupResource, err := r.GetScale(ctx, pidScaler.TargetSettings.Namespace, scaleTarget)
+				if err != nil {
+					r.Log.Error(err, "Failed to get scale target", "name", namespacedName.String())
+					tick.targetErr = err
+				} else {
+					tick.currentReplicas = &targetScale.Status.Replicas
+					if targetScale.Spec.Replicas != knownReplicas {
+						if velocity {
+							// the velocity form continues from replicas set outside the worker, e.g. by hand
+							pidController.SetCurrentOutput(float64(targetScale.Spec.Replicas))
+						}
+						knownReplicas = targetScale.Spec.Replicas
+					}
+					if !seeded {
+						// bumpless start from the replicas the target already runs
+						pidController.Seed(float64(targetScale.Spec.Replicas))
+						seeded = true
+					}
+				}
+
+				maxReplicas := effectiveMaxReplicas(pidScaler, metricSource)
+				pidController.SetOutputLimits(float64(pidScaler.TargetSettings.MinReplicas), float64(maxReplicas))
+				output := pidController.Update(float64(pidScaler.PidSettings.ReferenceSignal), value, now)
 				// update metrics
-				updateMetrics(namespacedName.String(), float64(lag), output, pidScaler)
+				updateMetrics(namespacedName.String(), metricSource, value, output, pidScaler)
+
+				recommendedReplicas := int32(math.Round(output))
+				replicas := recommendedReplicas
+				if targetScale != nil {
+					// stabilization windows and scaling policies limit the change from the current replicas
+					replicas = limiter.Limit(now, targetScale.Spec.Replicas, recommendedReplicas)
+				}
+				tick.output = output
+				tick.recommendedReplicas = recommendedReplicas
+				tick.desiredReplicas = replicas
+				tick.maxReplicas = maxReplicas
 
 				if now.Sub(lastScale) > (time.Duration(pidScaler.CooldownTimeout) * time.Second) {
 					lastScale = now
-					roundedOutput := math.Round(output)
-					replicas := int32(roundedOutput)
 					metrics.Replicas.WithLabelValues(namespacedName.String(), pidScaler.TargetSettings.Namespace,
-						pidScaler.TargetSettings.Deployment).Set(roundedOutput)
-					pidScalerCRD, err := r.GetCRD(ctx, namespacedName)
-					if err != nil {
-						r.Log.Error(err, "Failed to get PIDScaler")
-					} else {
-						dep, found := r.GetDeployment(ctx, pidScaler.TargetSettings.Namespace, pidScaler.TargetSettings.Deployment)
-						if pidScalerCRD.Spec.Target.DesiredReplicas != &replicas || (found == true && dep.Spec.Replicas != nil && *dep.Spec.Replicas != replicas) {
-							err = r.updateDesiredReplicas(ctx, namespacedName, replicas)
-							if err != nil {
-								r.Log.Error(err, "Failed to update PIDScaler desired replicas", "name", namespacedName.String())
-							}
+						scaleTarget.Name).Set(float64(replicas))
+					if targetScale != nil && targetScale.Spec.Replicas != replicas {
+						if err = r.ScaleReplicas(ctx, pidScaler.TargetSettings.Namespace, groupResource, targetScale, replicas); err != nil {
+							tick.scaleErr = err
+						} else {
+							limiter.RecordScale(now, targetScale.Spec.Replicas, replicas)
+							knownReplicas = replicas
+							scaleTime := metav1.NewTime(now)
+							tick.scaleTime = &scaleTime
 						}
 					}
+					if velocity && targetScale != nil && tick.scaleErr == nil && replicas != recommendedReplicas {
+						// the velocity form continues from the replicas the scaling behavior let through, not from
+						// the recommendation it held back. A cooldown alone keeps the output accumulating
+						pidController.SetCurrentOutput(float64(replicas))
+					}
 				}
+				tick.pidState = pidStateSnapshot(pidController.Snapshot(), lastScale)
+				r.recordTick(ctx, namespacedName, pidScaler, tick)
 			}
 			time.Sleep(time.Duration(pidScaler.Interval) * time.Second)
 		}
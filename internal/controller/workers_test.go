@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+	"github.com/timson/pidhpa-operator/internal/kafka"
+	"github.com/timson/pidhpa-operator/internal/metrics"
+	"github.com/timson/pidhpa-operator/internal/pid"
+	"github.com/timson/pidhpa-operator/internal/source"
+	"github.com/timson/pidhpa-operator/internal/storage"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/scale"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakePartitionedSource reports a fixed partition count
+type fakePartitionedSource struct {
+	fakeSource
+	partitions int32
+}
+
+func (f *fakePartitionedSource) Partitions() int32 {
+	return f.partitions
+}
+
+func (f *fakePartitionedSource) PartitionLags() []source.PartitionLag {
+	return nil
+}
+
+// valueSource reports a fixed value
+type valueSource struct {
+	fakeSource
+	value float64
+}
+
+func (f *valueSource) Fetch(_ context.Context) (float64, error) {
+	return f.value, nil
+}
+
+var _ = Describe("Worker helpers", func() {
+	Context("effectiveMaxReplicas", func() {
+		newState := func(capToPartitions bool) *storage.PIDScalerState {
+			return &storage.PIDScalerState{
+				TargetSettings: pidscalerv1.TargetSettings{MinReplicas: 2, MaxReplicas: 20},
+				KafkaSettings:  pidscalerv1.KafkaSettings{CapToPartitions: capToPartitions},
+			}
+		}
+
+		It("should keep MaxReplicas when capping is disabled", func() {
+			Expect(effectiveMaxReplicas(newState(false), &fakePartitionedSource{partitions: 6})).To(Equal(int32(20)))
+		})
+
+		It("should cap MaxReplicas to the partition count", func() {
+			Expect(effectiveMaxReplicas(newState(true), &fakePartitionedSource{partitions: 6})).To(Equal(int32(6)))
+		})
+
+		It("should never cap below MinReplicas", func() {
+			Expect(effectiveMaxReplicas(newState(true), &fakePartitionedSource{partitions: 1})).To(Equal(int32(2)))
+		})
+
+		It("should ignore sources without partitions", func() {
+			Expect(effectiveMaxReplicas(newState(true), &fakeSource{})).To(Equal(int32(20)))
+			Expect(effectiveMaxReplicas(newState(true), &fakePartitionedSource{partitions: 0})).To(Equal(int32(20)))
+		})
+	})
+
+	Context("updateMetrics", func() {
+		const nsName = "default/metrics"
+
+		AfterEach(func() {
+			deleteSourceMetrics(nsName)
+		})
+
+		It("should label the source value with the source type and drop it with the source", func() {
+			state := &storage.PIDScalerState{}
+			updateMetrics(nsName, &fakeSource{}, 42, 3, state)
+			Expect(testutil.ToFloat64(metrics.SourceValue.WithLabelValues(nsName, pidscalerv1.SourceTypeKafka))).
+				To(Equal(42.0))
+
+			deleteSourceMetrics(nsName)
+			Expect(metrics.SourceValue.DeletePartialMatch(prometheus.Labels{"namespaced_name": nsName})).To(BeZero())
+		})
+
+		It("should drop the lag series of the previous lag mode", func() {
+			state := &storage.PIDScalerState{KafkaSettings: pidscalerv1.KafkaSettings{Group: "group"}}
+			updateMetrics(nsName, &fakeSource{}, 100, 3, state)
+			state.KafkaSettings.LagMode = kafka.LagModeTime
+			updateMetrics(nsName, &fakeSource{}, 30, 3, state)
+			Expect(metrics.KafkaLag.DeletePartialMatch(prometheus.Labels{"namespaced_name": nsName})).To(BeZero())
+			Expect(metrics.KafkaLagSeconds.DeletePartialMatch(prometheus.Labels{"namespaced_name": nsName})).
+				To(Equal(1))
+		})
+	})
+
+	Context("kafkaGroupStatePolicy", func() {
+		It("should use the default policy when not configured", func() {
+			Expect(kafkaGroupStatePolicy(nil)).To(Equal(kafka.DefaultGroupStatePolicy()))
+		})
+
+		It("should override only the configured states", func() {
+			policy := kafkaGroupStatePolicy(&pidscalerv1.GroupStatePolicy{Empty: kafka.GroupStateActionError})
+			Expect(policy.Action(kafka.GroupStateEmpty)).To(Equal(kafka.GroupStateActionError))
+			Expect(policy.Action(kafka.GroupStatePreparingRebalance)).To(Equal(kafka.GroupStateActionCompute))
+			Expect(policy.Action(kafka.GroupStateDead)).To(Equal(kafka.GroupStateActionError))
+		})
+	})
+
+	Context("antiWindupStrategy", func() {
+		It("should map every anti_windup value", func() {
+			Expect(antiWindupStrategy(pidscalerv1.AntiWindupBackCalculation)).To(Equal(pid.BackCalculation))
+			Expect(antiWindupStrategy(pidscalerv1.AntiWindupClamp)).To(Equal(pid.IntegralClamp))
+			Expect(antiWindupStrategy(pidscalerv1.AntiWindupConditional)).To(Equal(pid.ConditionalIntegration))
+			Expect(antiWindupStrategy("")).To(Equal(pid.ConditionalIntegration))
+		})
+	})
+
+	Context("scalingLimitedCondition", func() {
+		state := &storage.PIDScalerState{
+			TargetSettings: pidscalerv1.TargetSettings{MinReplicas: 2, MaxReplicas: 20},
+		}
+
+		It("should not be limited within the range", func() {
+			condition := scalingLimitedCondition(state, 5, 5, 20)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(pidscalerv1.ReasonDesiredWithinRange))
+		})
+
+		It("should report the output limits", func() {
+			Expect(scalingLimitedCondition(state, 2, 2, 20).Reason).To(Equal(pidscalerv1.ReasonTooFewReplicas))
+			Expect(scalingLimitedCondition(state, 20, 20, 20).Reason).To(Equal(pidscalerv1.ReasonTooManyReplicas))
+			Expect(scalingLimitedCondition(state, 20, 20, 20).Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should report the partition cap", func() {
+			Expect(scalingLimitedCondition(state, 6, 6, 6).Reason).To(Equal(pidscalerv1.ReasonCappedToPartitions))
+		})
+
+		It("should report the scaling behavior limits", func() {
+			Expect(scalingLimitedCondition(state, 20, 8, 20).Reason).To(Equal(pidscalerv1.ReasonScaleUpLimit))
+			Expect(scalingLimitedCondition(state, 2, 10, 20).Reason).To(Equal(pidscalerv1.ReasonScaleDownLimit))
+			Expect(scalingLimitedCondition(state, 2, 10, 20).Status).To(Equal(metav1.ConditionTrue))
+		})
+	})
+})
+
+var _ = Describe("Worker", func() {
+	const name = "velocity-worker"
+
+	ctx := context.Background()
+	namespacedName := types.NamespacedName{Name: name, Namespace: "default"}
+	var reconciler *PIDScalerReconciler
+
+	BeforeEach(func() {
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		scaleClient, err := scale.NewForConfig(cfg, k8sClient.RESTMapper(), dynamic.LegacyAPIPathResolverFunc,
+			scale.NewDiscoveryScaleKindResolver(discoveryClient))
+		Expect(err).NotTo(HaveOccurred())
+		reconciler = &PIDScalerReconciler{
+			Client:          k8sClient,
+			Scheme:          k8sClient.Scheme(),
+			Log:             zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)),
+			Storage:         storage.NewPIDScalerStorage(),
+			ScaleClient:     scaleClient,
+			OperatorContext: ctx,
+			wg:              &sync.WaitGroup{},
+			SourceFactory: func(_ *storage.PIDScalerState) (source.MetricSource, error) {
+				return &valueSource{value: 20}, nil
+			},
+		}
+
+		labels := map[string]string{"app": name}
+		Expect(k8sClient.Create(ctx, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: ptr.To(int32(2)),
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "app", Image: "nginx"}},
+					},
+				},
+			},
+		})).To(Succeed())
+		Expect(k8sClient.Create(ctx, &pidscalerv1.PIDScaler{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: pidscalerv1.PIDScalerSpec{
+				Target: pidscalerv1.TargetSettings{
+					Deployment:  name,
+					Namespace:   "default",
+					MinReplicas: 1,
+					MaxReplicas: 100,
+				},
+				PID: pidscalerv1.PIDSettings{
+					Mode:            pidscalerv1.PIDModeVelocity,
+					Kp:              "0.5",
+					Ki:              "0.5",
+					Kd:              "0",
+					ReferenceSignal: 10,
+				},
+				Kafka: &pidscalerv1.KafkaSettings{
+					Topic:   "test-topic",
+					Group:   "test-group",
+					Brokers: []string{"broker1:9092"},
+				},
+				CooldownTimeout: 3600,
+				Interval:        1,
+			},
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		reconciler.StopWorker(namespacedName)
+		reconciler.WaitForAllWorkers()
+		Expect(k8sClient.Delete(ctx, &pidscalerv1.PIDScaler{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		})).To(Succeed())
+		Expect(k8sClient.Delete(ctx, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		})).To(Succeed())
+	})
+
+	It("should keep the velocity output growing while the cooldown holds the target", func() {
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("scaling once before the cooldown starts")
+		deployment := &appsv1.Deployment{}
+		Eventually(func() int32 {
+			Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+			return *deployment.Spec.Replicas
+		}, 10*time.Second).ShouldNot(Equal(int32(2)))
+		scaledReplicas := *deployment.Spec.Replicas
+
+		By("accumulating the error during the cooldown")
+		Eventually(func() float64 {
+			resource := &pidscalerv1.PIDScaler{}
+			Expect(k8sClient.Get(ctx, namespacedName, resource)).To(Succeed())
+			output, _ := strconv.ParseFloat(resource.Status.LastOutput, 64)
+			return output
+		}, 10*time.Second).Should(BeNumerically(">", float64(scaledReplicas)+10))
+		Expect(k8sClient.Get(ctx, namespacedName, deployment)).To(Succeed())
+		Expect(*deployment.Spec.Replicas).To(Equal(scaledReplicas))
+	})
+})
@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"fmt"
+)
+
+// Consumer group states as reported by DescribeGroups
+const (
+	GroupStateStable              = "Stable"
+	GroupStateEmpty               = "Empty"
+	GroupStatePreparingRebalance  = "PreparingRebalance"
+	GroupStateCompletingRebalance = "CompletingRebalance"
+	GroupStateDead                = "Dead"
+)
+
+// GroupStates lists all known consumer group states
+var GroupStates = []string{
+	GroupStateStable,
+	GroupStateEmpty,
+	GroupStatePreparingRebalance,
+	GroupStateCompletingRebalance,
+	GroupStateDead,
+}
+
+// Actions taken when lag is requested for a group in a given state
+const (
+	// GroupStateActionCompute computes lag from committed offsets
+	GroupStateActionCompute = "Compute"
+	// GroupStateActionSkip skips the tick, returning ErrConsumerGroupNotStable
+	GroupStateActionSkip = "Skip"
+	// GroupStateActionError fails the tick, returning ErrConsumerGroupState
+	GroupStateActionError = "Error"
+)
+
+// GroupStatePolicy maps non-Stable group states to actions, lag is always computed for Stable
+// groups and states missing from the policy are skipped
+type GroupStatePolicy map[string]string
+
+// DefaultGroupStatePolicy keeps tracking lag while consumers are down or rebalancing, and treats a dead group as an error
+func DefaultGroupStatePolicy() GroupStatePolicy {
+	return GroupStatePolicy{
+		GroupStateEmpty:               GroupStateActionCompute,
+		GroupStatePreparingRebalance:  GroupStateActionCompute,
+		GroupStateCompletingRebalance: GroupStateActionSkip,
+		GroupStateDead:                GroupStateActionError,
+	}
+}
+
+// Action returns the action for the group state
+func (p GroupStatePolicy) Action(state string) string {
+	if state == GroupStateStable {
+		return GroupStateActionCompute
+	}
+	if action, found := p[state]; found {
+		return action
+	}
+	return GroupStateActionSkip
+}
+
+// Check returns nil if lag should be computed for the group state
+func (p GroupStatePolicy) Check(state string) error {
+	switch p.Action(state) {
+	case GroupStateActionCompute:
+		return nil
+	case GroupStateActionError:
+		return fmt.Errorf("%w: %s", ErrConsumerGroupState, state)
+	default:
+		return ErrConsumerGroupNotStable
+	}
+}
@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGroupStatePolicyCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      GroupStatePolicy
+		state       string
+		expectedErr error
+	}{
+		{name: "Stable is always computed", policy: nil, state: GroupStateStable},
+		{name: "Nil policy skips Empty", policy: nil, state: GroupStateEmpty, expectedErr: ErrConsumerGroupNotStable},
+		{name: "Default computes Empty", policy: DefaultGroupStatePolicy(), state: GroupStateEmpty},
+		{name: "Default computes PreparingRebalance", policy: DefaultGroupStatePolicy(), state: GroupStatePreparingRebalance},
+		{
+			name:        "Default skips CompletingRebalance",
+			policy:      DefaultGroupStatePolicy(),
+			state:       GroupStateCompletingRebalance,
+			expectedErr: ErrConsumerGroupNotStable,
+		},
+		{name: "Default fails Dead", policy: DefaultGroupStatePolicy(), state: GroupStateDead, expectedErr: ErrConsumerGroupState},
+		{name: "Unknown state is skipped", policy: DefaultGroupStatePolicy(), state: "Unknown", expectedErr: ErrConsumerGroupNotStable},
+		{
+			name:        "Custom policy",
+			policy:      GroupStatePolicy{GroupStateEmpty: GroupStateActionError},
+			state:       GroupStateEmpty,
+			expectedErr: ErrConsumerGroupState,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.state)
+			if tt.expectedErr == nil && err != nil {
+				t.Errorf("Check(%s) error = %v, expected nil", tt.state, err)
+			}
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Check(%s) error = %v, expected %v", tt.state, err, tt.expectedErr)
+			}
+		})
+	}
+}
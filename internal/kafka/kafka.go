@@ -2,8 +2,13 @@ package kafka
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"slices"
 
+	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
 	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kgo"
 	"github.com/twmb/franz-go/pkg/kversion"
@@ -13,49 +18,110 @@ import (
 )
 
 var ErrConsumerGroupNotStable = errors.New("consumer group is not stable")
+var ErrConsumerGroupState = errors.New("consumer group is in a state configured as error")
 var ErrNoKafkaClient = errors.New("no connection to Kafka")
 var ErrTopicNotFound = errors.New("topic not found")
 var ErrGroupNotFound = errors.New("group not found")
+var ErrNoBrokers = errors.New("no Kafka brokers configured")
+var ErrUnknownSASLMechanism = errors.New("unknown SASL mechanism")
 
-func GetKafkaLag(ctx context.Context, kafkaClient *kadm.Client, group string, topic string) (int64, error) {
-	if kafkaClient != nil {
-		lags, err := kafkaClient.Lag(ctx, group)
-		if err != nil {
-			return 0, err
-		}
-		lag, found := lags[group]
-		if !found {
-			return 0, ErrGroupNotFound
-		}
-		if lag.State != "Stable" {
-			return 0, ErrConsumerGroupNotStable
+// ValidateSASLMechanism returns ErrUnknownSASLMechanism if the mechanism is not one of pidscalerv1.SASLMechanisms
+func ValidateSASLMechanism(saslMechanism string) error {
+	if !slices.Contains(pidscalerv1.SASLMechanisms, saslMechanism) {
+		return fmt.Errorf("%w %q", ErrUnknownSASLMechanism, saslMechanism)
+	}
+	return nil
+}
+
+// GetGroupLag returns the per-partition lag and the state of the group, the policy decides
+// which states lag is computed in, a nil policy computes lag of Stable groups only
+func GetGroupLag(ctx context.Context, kafkaClient *kadm.Client, group string, policy GroupStatePolicy) (kadm.GroupLag, string, error) {
+	if kafkaClient == nil {
+		return nil, "", ErrNoKafkaClient
+	}
+	lags, err := kafkaClient.Lag(ctx, group)
+	if err != nil {
+		return nil, "", err
+	}
+	lag, found := lags[group]
+	if !found {
+		return nil, "", ErrGroupNotFound
+	}
+	if err = policy.Check(lag.State); err != nil {
+		return nil, lag.State, err
+	}
+	if err = lag.Error(); err != nil {
+		return nil, lag.State, err
+	}
+	return lag.Lag, lag.State, nil
+}
+
+// ClientConfig holds connection settings of a Kafka admin client
+type ClientConfig struct {
+	Brokers       []string
+	UseSASL       bool
+	SASLMechanism string
+	Username      string
+	Password      string
+	// OAuthTokenURL and OAuthScopes configure the client credentials grant of the oauthbearer mechanism,
+	// Username and Password are used as the client ID and secret
+	OAuthTokenURL string
+	OAuthScopes   []string
+	// TLS enables TLS when not nil
+	TLS *tls.Config
+}
+
+// NewTLSConfig builds a TLS config from PEM encoded CA bundle and client certificate and key, all optional
+func NewTLSConfig(caPEM []byte, certPEM []byte, keyPEM []byte, insecureSkipVerify bool, serverName string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecureSkipVerify,
+		ServerName:         serverName,
+	}
+	if len(caPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("no valid certificates found in CA bundle")
 		}
-		lagsByTopic := lag.Lag.TotalByTopic()
-		topicLag, topicFound := lagsByTopic[topic]
-		if !topicFound {
-			return 0, ErrTopicNotFound
+		tlsConfig.RootCAs = pool
+	}
+	if len(certPEM) > 0 || len(keyPEM) > 0 {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
 		}
-		return topicLag.Lag, nil
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
-	return 0, ErrNoKafkaClient
+	return tlsConfig, nil
 }
 
-func NewKafkaClient(brokers []string, useSASL bool, saslMechanism string, username string, password string) (*kadm.Client, error) {
+func NewKafkaClient(cfg ClientConfig) (*kadm.Client, error) {
 	options := []kgo.Opt{
-		kgo.SeedBrokers(brokers...),
+		kgo.SeedBrokers(cfg.Brokers...),
 		kgo.MaxVersions(kversion.V2_4_0()),
 	}
-	if useSASL == true {
+	if cfg.UseSASL == true {
 		var sm sasl.Mechanism
-		if saslMechanism == "plain" {
-			sm = plain.Auth{User: username, Pass: password}.AsMechanism()
-		} else if saslMechanism == "scram_sha256" {
-			sm = scram.Auth{User: username, Pass: password}.AsSha256Mechanism()
-		} else if saslMechanism == "scram_sha512" {
-			sm = scram.Auth{User: username, Pass: password}.AsSha512Mechanism()
+		switch cfg.SASLMechanism {
+		case pidscalerv1.SASLMechanismPlain:
+			sm = plain.Auth{User: cfg.Username, Pass: cfg.Password}.AsMechanism()
+		case pidscalerv1.SASLMechanismScramSha256:
+			sm = scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha256Mechanism()
+		case pidscalerv1.SASLMechanismScramSha512:
+			sm = scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha512Mechanism()
+		case pidscalerv1.SASLMechanismOAuthBearer:
+			if cfg.OAuthTokenURL == "" {
+				return nil, errors.New("oauthbearer mechanism requires a token URL")
+			}
+			sm = newOAuthMechanism(newOAuthTokenSource(cfg.Username, cfg.Password, cfg.OAuthTokenURL, cfg.OAuthScopes))
+		default:
+			return nil, ValidateSASLMechanism(cfg.SASLMechanism)
 		}
 		options = append(options, kgo.SASL(sm))
 	}
+	if cfg.TLS != nil {
+		options = append(options, kgo.DialTLSConfig(cfg.TLS))
+	}
 	kafkaClient, err := kgo.NewClient(options...)
 	if err != nil {
 		return nil, err
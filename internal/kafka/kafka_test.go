@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+)
+
+func TestValidateSASLMechanism(t *testing.T) {
+	for _, mechanism := range []string{pidscalerv1.SASLMechanismPlain, pidscalerv1.SASLMechanismScramSha256, pidscalerv1.SASLMechanismScramSha512} {
+		if err := ValidateSASLMechanism(mechanism); err != nil {
+			t.Errorf("Expected %q to be supported, got %v", mechanism, err)
+		}
+	}
+	if err := ValidateSASLMechanism("kerberos"); !errors.Is(err, ErrUnknownSASLMechanism) {
+		t.Errorf("Expected ErrUnknownSASLMechanism, got %v", err)
+	}
+}
+
+func TestNewKafkaClientRejectsUnknownSASLMechanism(t *testing.T) {
+	client, err := NewKafkaClient(ClientConfig{
+		Brokers:       []string{"localhost:9092"},
+		UseSASL:       true,
+		SASLMechanism: "kerberos",
+		Username:      "user",
+		Password:      "pass",
+	})
+	if !errors.Is(err, ErrUnknownSASLMechanism) {
+		t.Errorf("Expected ErrUnknownSASLMechanism, got %v", err)
+	}
+	if client != nil {
+		t.Errorf("Expected no client for unknown SASL mechanism")
+	}
+}
+
+func TestNewKafkaClientWithSASL(t *testing.T) {
+	client, err := NewKafkaClient(ClientConfig{
+		Brokers:       []string{"localhost:9092"},
+		UseSASL:       true,
+		SASLMechanism: pidscalerv1.SASLMechanismScramSha256,
+		Username:      "user",
+		Password:      "pass",
+	})
+	if err != nil {
+		t.Fatalf("NewKafkaClient() error = %v", err)
+	}
+	client.Close()
+}
+
+func generateCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certPEM, keyPEM := generateCertificate(t)
+
+	tlsConfig, err := NewTLSConfig(certPEM, certPEM, keyPEM, false, "kafka.internal")
+	if err != nil {
+		t.Fatalf("NewTLSConfig() error = %v", err)
+	}
+	if tlsConfig.RootCAs == nil {
+		t.Errorf("Expected RootCAs to be set from CA bundle")
+	}
+	if len(tlsConfig.Certificates) != 1 {
+		t.Errorf("Expected client certificate to be loaded")
+	}
+	if tlsConfig.ServerName != "kafka.internal" {
+		t.Errorf("Unexpected server name %q", tlsConfig.ServerName)
+	}
+
+	tlsConfig, err = NewTLSConfig(nil, nil, nil, true, "")
+	if err != nil {
+		t.Fatalf("NewTLSConfig() error = %v", err)
+	}
+	if tlsConfig.RootCAs != nil || len(tlsConfig.Certificates) != 0 || !tlsConfig.InsecureSkipVerify {
+		t.Errorf("Expected plain TLS config using system roots")
+	}
+
+	if _, err = NewTLSConfig([]byte("not a certificate"), nil, nil, false, ""); err == nil {
+		t.Errorf("Expected error for invalid CA bundle")
+	}
+	if _, err = NewTLSConfig(nil, certPEM, nil, false, ""); err == nil {
+		t.Errorf("Expected error for client certificate without key")
+	}
+}
@@ -0,0 +1,124 @@
+package kafka
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/timson/pidhpa-operator/internal/source"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+const (
+	AggregationSum  = "sum"
+	AggregationMax  = "max"
+	AggregationMean = "mean"
+
+	LagModeOffsets = "offsets"
+	LagModeTime    = "time"
+)
+
+// LagOptions selects the topics of a consumer group and how their lag is combined into one value
+type LagOptions struct {
+	// Topics are consumed topics that must be present in the group lag
+	Topics []string
+	// TopicPattern matches additional consumed topics, it may match nothing if Topics is not empty
+	TopicPattern *regexp.Regexp
+	// Aggregation is one of sum, max or mean, sum is used when empty
+	Aggregation string
+	// Mode is offsets (lag in messages) or time (estimated delay in seconds), offsets is used when empty
+	Mode string
+	// GroupStatePolicy decides which group states lag is computed in
+	GroupStatePolicy GroupStatePolicy
+}
+
+// CompileTopicPattern compiles a topic regex anchored to the whole topic name, so orders-.* doesn't match new-orders-1
+func CompileTopicPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// SelectTopics returns the sorted names of topics selected by the options
+func (o *LagOptions) SelectTopics(lags kadm.GroupTopicsLag) ([]string, error) {
+	selected := make(map[string]struct{})
+	for _, topic := range o.Topics {
+		if _, found := lags[topic]; !found {
+			return nil, fmt.Errorf("%w: %s", ErrTopicNotFound, topic)
+		}
+		selected[topic] = struct{}{}
+	}
+	if o.TopicPattern != nil {
+		for topic := range lags {
+			if o.TopicPattern.MatchString(topic) {
+				selected[topic] = struct{}{}
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, ErrTopicNotFound
+	}
+	topics := make([]string, 0, len(selected))
+	for topic := range selected {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// AggregateLag combines the lag of the selected topics
+func (o *LagOptions) AggregateLag(lags kadm.GroupTopicsLag) (float64, error) {
+	topics, err := o.SelectTopics(lags)
+	if err != nil {
+		return 0, err
+	}
+	values := make([]float64, 0, len(topics))
+	for _, topic := range topics {
+		values = append(values, float64(lags[topic].Lag))
+	}
+	return aggregate(values, o.Aggregation)
+}
+
+// aggregate combines per-topic values, values must not be empty
+func aggregate(values []float64, aggregation string) (float64, error) {
+	var total, maximum float64
+	for _, value := range values {
+		total += value
+		if value > maximum {
+			maximum = value
+		}
+	}
+	switch aggregation {
+	case AggregationSum, "":
+		return total, nil
+	case AggregationMax:
+		return maximum, nil
+	case AggregationMean:
+		return total / float64(len(values)), nil
+	default:
+		return 0, fmt.Errorf("unknown lag aggregation %q", aggregation)
+	}
+}
+
+// PartitionLags returns the lag of every partition of the given topics, sorted by topic and partition
+func PartitionLags(groupLag kadm.GroupLag, topics []string) []source.PartitionLag {
+	var lags []source.PartitionLag
+	for _, topic := range topics {
+		for partition, memberLag := range groupLag[topic] {
+			lag := memberLag.Lag
+			if lag < 0 {
+				// commit or list offset error, reported by kadm as -1
+				lag = 0
+			}
+			lags = append(lags, source.PartitionLag{Topic: topic, Partition: partition, Lag: lag})
+		}
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags
+}
@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/timson/pidhpa-operator/internal/source"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+func topicLags(lags map[string]int64) kadm.GroupTopicsLag {
+	result := make(kadm.GroupTopicsLag, len(lags))
+	for topic, lag := range lags {
+		result[topic] = kadm.TopicLag{Topic: topic, Lag: lag}
+	}
+	return result
+}
+
+func TestCompileTopicPattern(t *testing.T) {
+	pattern, err := CompileTopicPattern("orders-.*")
+	if err != nil {
+		t.Fatalf("CompileTopicPattern() error = %v", err)
+	}
+	if !pattern.MatchString("orders-eu") {
+		t.Errorf("Expected orders-eu to match")
+	}
+	if pattern.MatchString("new-orders-eu") {
+		t.Errorf("Expected pattern to be anchored at the start of the topic name")
+	}
+	if pattern, err = CompileTopicPattern(""); pattern != nil || err != nil {
+		t.Errorf("Expected no pattern for empty string")
+	}
+	if _, err = CompileTopicPattern("orders-("); err == nil {
+		t.Errorf("Expected error for invalid pattern")
+	}
+}
+
+func TestAggregateLag(t *testing.T) {
+	lags := topicLags(map[string]int64{
+		"orders-eu": 100,
+		"orders-us": 300,
+		"payments":  50,
+	})
+	ordersPattern, _ := CompileTopicPattern("orders-.*")
+
+	tests := []struct {
+		name        string
+		options     LagOptions
+		expected    float64
+		expectedErr error
+	}{
+		{
+			name:     "Single topic",
+			options:  LagOptions{Topics: []string{"payments"}},
+			expected: 50,
+		},
+		{
+			name:     "Sum over topics",
+			options:  LagOptions{Topics: []string{"orders-eu", "payments"}, Aggregation: AggregationSum},
+			expected: 150,
+		},
+		{
+			name:     "Max over pattern",
+			options:  LagOptions{TopicPattern: ordersPattern, Aggregation: AggregationMax},
+			expected: 300,
+		},
+		{
+			name:     "Mean over pattern",
+			options:  LagOptions{TopicPattern: ordersPattern, Aggregation: AggregationMean},
+			expected: 200,
+		},
+		{
+			name:     "Topics and pattern are deduplicated",
+			options:  LagOptions{Topics: []string{"orders-eu", "payments"}, TopicPattern: ordersPattern},
+			expected: 450,
+		},
+		{
+			name:        "Missing explicit topic",
+			options:     LagOptions{Topics: []string{"refunds"}},
+			expectedErr: ErrTopicNotFound,
+		},
+		{
+			name:        "Pattern matches nothing",
+			options:     LagOptions{TopicPattern: regexpMust(t, "refunds-.*")},
+			expectedErr: ErrTopicNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.options.AggregateLag(lags)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("AggregateLag() error = %v, expected %v", err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AggregateLag() error = %v", err)
+			}
+			if value != tt.expected {
+				t.Errorf("AggregateLag() = %f, expected %f", value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSelectTopics(t *testing.T) {
+	lags := topicLags(map[string]int64{"orders-us": 1, "orders-eu": 2, "payments": 3})
+	options := LagOptions{TopicPattern: regexpMust(t, "orders-.*")}
+	topics, err := options.SelectTopics(lags)
+	if err != nil {
+		t.Fatalf("SelectTopics() error = %v", err)
+	}
+	if !reflect.DeepEqual(topics, []string{"orders-eu", "orders-us"}) {
+		t.Errorf("SelectTopics() = %v", topics)
+	}
+}
+
+func regexpMust(t *testing.T, pattern string) *regexp.Regexp {
+	compiled, err := CompileTopicPattern(pattern)
+	if err != nil {
+		t.Fatalf("CompileTopicPattern() error = %v", err)
+	}
+	return compiled
+}
+
+func TestPartitionLags(t *testing.T) {
+	groupLag := kadm.GroupLag{
+		"orders": {
+			1: {Topic: "orders", Partition: 1, Lag: 20},
+			0: {Topic: "orders", Partition: 0, Lag: 10},
+			2: {Topic: "orders", Partition: 2, Lag: -1},
+		},
+		"payments": {
+			0: {Topic: "payments", Partition: 0, Lag: 5},
+		},
+	}
+
+	lags := PartitionLags(groupLag, []string{"orders"})
+	expected := []source.PartitionLag{
+		{Topic: "orders", Partition: 0, Lag: 10},
+		{Topic: "orders", Partition: 1, Lag: 20},
+		{Topic: "orders", Partition: 2, Lag: 0},
+	}
+	if !reflect.DeepEqual(lags, expected) {
+		t.Errorf("PartitionLags() = %v, expected %v", lags, expected)
+	}
+}
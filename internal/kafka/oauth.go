@@ -0,0 +1,37 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/oauth"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// tokenRefreshMargin is how long before expiry a cached token is replaced by a fresh one
+const tokenRefreshMargin = 30 * time.Second
+
+// newOAuthTokenSource returns a token source using the client credentials grant, tokens are cached
+// and refreshed tokenRefreshMargin before they expire
+func newOAuthTokenSource(clientID string, clientSecret string, tokenURL string, scopes []string) oauth2.TokenSource {
+	cfg := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
+		Scopes:       scopes,
+	}
+	return oauth2.ReuseTokenSourceWithExpiry(nil, cfg.TokenSource(context.Background()), tokenRefreshMargin)
+}
+
+// newOAuthMechanism returns an OAUTHBEARER mechanism asking the token source for a token on every authentication
+func newOAuthMechanism(tokenSource oauth2.TokenSource) sasl.Mechanism {
+	return oauth.Oauth(func(_ context.Context) (oauth.Auth, error) {
+		token, err := tokenSource.Token()
+		if err != nil {
+			return oauth.Auth{}, err
+		}
+		return oauth.Auth{Token: token.AccessToken}, nil
+	})
+}
@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+)
+
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse token request: %v", err)
+		}
+		if r.Form.Get("grant_type") != "client_credentials" {
+			t.Errorf("Unexpected grant type %q", r.Form.Get("grant_type"))
+		}
+		if clientID, clientSecret, ok := r.BasicAuth(); !ok || clientID != "client" || clientSecret != "secret" {
+			t.Errorf("Unexpected client credentials")
+		}
+		n := atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestOAuthTokenSourceReusesValidToken(t *testing.T) {
+	server, requests := newTokenServer(t, 3600)
+	tokenSource := newOAuthTokenSource("client", "secret", server.URL, []string{"kafka"})
+
+	for i := 0; i < 3; i++ {
+		token, err := tokenSource.Token()
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		if token.AccessToken != "token-1" {
+			t.Errorf("Expected cached token, got %q", token.AccessToken)
+		}
+	}
+	if atomic.LoadInt32(requests) != 1 {
+		t.Errorf("Expected a single token request, got %d", atomic.LoadInt32(requests))
+	}
+}
+
+func TestOAuthTokenSourceRefreshesBeforeExpiry(t *testing.T) {
+	// token lifetime is shorter than the refresh margin, so every call fetches a new token
+	server, requests := newTokenServer(t, 5)
+	tokenSource := newOAuthTokenSource("client", "secret", server.URL, nil)
+
+	first, err := tokenSource.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	second, err := tokenSource.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if first.AccessToken == second.AccessToken {
+		t.Errorf("Expected token to be refreshed before expiry")
+	}
+	if atomic.LoadInt32(requests) != 2 {
+		t.Errorf("Expected two token requests, got %d", atomic.LoadInt32(requests))
+	}
+}
+
+func TestOAuthMechanism(t *testing.T) {
+	server, _ := newTokenServer(t, 3600)
+	mechanism := newOAuthMechanism(newOAuthTokenSource("client", "secret", server.URL, nil))
+
+	if mechanism.Name() != "OAUTHBEARER" {
+		t.Errorf("Unexpected mechanism name %q", mechanism.Name())
+	}
+	_, initial, err := mechanism.Authenticate(context.Background(), "broker:9092")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if !strings.Contains(string(initial), "auth=Bearer token-1") {
+		t.Errorf("Expected bearer token in initial message, got %q", initial)
+	}
+}
+
+func TestNewKafkaClientOAuthRequiresTokenURL(t *testing.T) {
+	_, err := NewKafkaClient(ClientConfig{
+		Brokers:       []string{"localhost:9092"},
+		UseSASL:       true,
+		SASLMechanism: pidscalerv1.SASLMechanismOAuthBearer,
+		Username:      "client",
+		Password:      "secret",
+	})
+	if err == nil {
+		t.Errorf("Expected error for oauthbearer without token URL")
+	}
+}
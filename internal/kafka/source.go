@@ -0,0 +1,134 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/timson/pidhpa-operator/internal/source"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// Source is a metric source reporting consumer group lag aggregated over the selected topics
+type Source struct {
+	client  *kadm.Client
+	group   string
+	options LagOptions
+
+	mu            sync.Mutex
+	partitionLags []source.PartitionLag
+	estimators    map[string]*timeLagEstimator
+	groupState    string
+}
+
+func NewSource(cfg ClientConfig, group string, options LagOptions) (*Source, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, ErrNoBrokers
+	}
+	if len(options.Topics) == 0 && options.TopicPattern == nil {
+		return nil, fmt.Errorf("%w: no topics or topic pattern configured", ErrTopicNotFound)
+	}
+	client, err := NewKafkaClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Source{
+		client:     client,
+		group:      group,
+		options:    options,
+		estimators: make(map[string]*timeLagEstimator),
+	}, nil
+}
+
+func (s *Source) Fetch(ctx context.Context) (float64, error) {
+	groupLag, groupState, err := GetGroupLag(ctx, s.client, s.group, s.options.GroupStatePolicy)
+	s.mu.Lock()
+	s.groupState = groupState
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	lags := groupLag.TotalByTopic()
+	topics, err := s.options.SelectTopics(lags)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	s.partitionLags = PartitionLags(groupLag, topics)
+	s.mu.Unlock()
+	if s.options.Mode == LagModeTime {
+		return s.estimateTimeLag(groupLag, lags, topics, time.Now())
+	}
+	return s.options.AggregateLag(lags)
+}
+
+// estimateTimeLag returns the aggregated delay in seconds of the selected topics
+func (s *Source) estimateTimeLag(groupLag kadm.GroupLag, lags kadm.GroupTopicsLag, topics []string, now time.Time) (float64, error) {
+	values := make([]float64, 0, len(topics))
+	ready := true
+	for _, topic := range topics {
+		estimator, found := s.estimators[topic]
+		if !found {
+			estimator = &timeLagEstimator{}
+			s.estimators[topic] = estimator
+		}
+		end, err := endOffset(groupLag[topic])
+		if err != nil {
+			// skip the sample, the estimator keeps its state until the offsets can be listed again, the
+			// remaining topics are still sampled
+			ready = false
+			continue
+		}
+		delay, err := estimator.Estimate(lags[topic].Lag, end, now)
+		if err != nil {
+			// keep sampling the remaining topics so all of them are ready on the next tick
+			ready = false
+			continue
+		}
+		values = append(values, delay)
+	}
+	if !ready {
+		return 0, source.ErrNotReady
+	}
+	return aggregate(values, s.options.Aggregation)
+}
+
+// Partitions returns the number of partitions of all selected topics, the most consumers of the group
+// that can be assigned work
+func (s *Source) Partitions() int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int32(len(s.partitionLags))
+}
+
+// State returns the consumer group state observed by the last Fetch
+func (s *Source) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.groupState
+}
+
+func (s *Source) PartitionLags() []source.PartitionLag {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.partitionLags
+}
+
+func (s *Source) Close() {
+	if s.client != nil {
+		s.client.Close()
+	}
+}
+
+func (s *Source) Describe() string {
+	description := fmt.Sprintf("kafka(group=%s, topics=%s", s.group, strings.Join(s.options.Topics, ","))
+	if s.options.TopicPattern != nil {
+		description += fmt.Sprintf(", pattern=%s", s.options.TopicPattern)
+	}
+	if s.options.Mode == LagModeTime {
+		description += ", mode=time"
+	}
+	return description + ")"
+}
@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/timson/pidhpa-operator/internal/source"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// produceRateSmoothing is the weight of the newest produce rate sample in the moving average
+const produceRateSmoothing = 0.3
+
+// timeLagEstimator estimates how many seconds a consumer is behind a topic from its offset lag
+// and the produce rate observed between two samples of the topic end offset
+type timeLagEstimator struct {
+	prevEnd   int64
+	prevTime  time.Time
+	rate      float64
+	lastDelay float64
+}
+
+// Estimate returns the estimated delay in seconds, or source.ErrNotReady until two samples were taken
+func (e *timeLagEstimator) Estimate(lag int64, endOffset int64, now time.Time) (float64, error) {
+	if e.prevTime.IsZero() || endOffset < e.prevEnd {
+		// first sample, or the topic was recreated and offsets restarted
+		e.prevEnd = endOffset
+		e.prevTime = now
+		e.rate = 0
+		e.lastDelay = 0
+		return 0, source.ErrNotReady
+	}
+	dt := now.Sub(e.prevTime).Seconds()
+	if dt <= 0 {
+		return e.lastDelay, nil
+	}
+	sample := float64(endOffset-e.prevEnd) / dt
+	if e.rate == 0 {
+		e.rate = sample
+	} else {
+		e.rate = produceRateSmoothing*sample + (1-produceRateSmoothing)*e.rate
+	}
+	e.prevEnd = endOffset
+	e.prevTime = now
+
+	switch {
+	case lag <= 0:
+		e.lastDelay = 0
+	case e.rate > 0:
+		e.lastDelay = float64(lag) / e.rate
+	default:
+		// nothing is produced but the lag isn't consumed either, so the oldest message keeps aging
+		e.lastDelay += dt
+	}
+	return e.lastDelay, nil
+}
+
+// endOffset returns the sum of end offsets of all partitions of a topic. It fails when the end offset of any
+// partition couldn't be listed, a partial sum would look like a recreated topic and reset the estimator
+func endOffset(partitions map[int32]kadm.GroupMemberLag) (int64, error) {
+	var total int64
+	for partition, partitionLag := range partitions {
+		if partitionLag.End.Err != nil {
+			return 0, fmt.Errorf("unable to list the end offset of partition %d: %w", partition, partitionLag.End.Err)
+		}
+		total += partitionLag.End.Offset
+	}
+	return total, nil
+}
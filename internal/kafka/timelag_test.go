@@ -0,0 +1,116 @@
+package kafka
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/timson/pidhpa-operator/internal/source"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+func TestTimeLagEstimator(t *testing.T) {
+	start := time.Now()
+	estimator := &timeLagEstimator{}
+
+	if _, err := estimator.Estimate(1000, 10000, start); !errors.Is(err, source.ErrNotReady) {
+		t.Fatalf("Expected ErrNotReady on first sample, got %v", err)
+	}
+
+	// 1000 messages in 10 seconds: 100 msg/s, 1000 messages behind is 10 seconds
+	delay, err := estimator.Estimate(1000, 11000, start.Add(10*time.Second))
+	if err != nil {
+		t.Fatalf("Estimate() error = %v", err)
+	}
+	if math.Abs(delay-10) > 1e-9 {
+		t.Errorf("Expected 10 seconds delay, got %f", delay)
+	}
+
+	// consumer caught up
+	delay, err = estimator.Estimate(0, 12000, start.Add(20*time.Second))
+	if err != nil {
+		t.Fatalf("Estimate() error = %v", err)
+	}
+	if delay != 0 {
+		t.Errorf("Expected no delay without lag, got %f", delay)
+	}
+}
+
+func TestTimeLagEstimatorSmoothsRate(t *testing.T) {
+	start := time.Now()
+	estimator := &timeLagEstimator{}
+	_, _ = estimator.Estimate(0, 0, start)
+	_, _ = estimator.Estimate(0, 1000, start.Add(10*time.Second)) // 100 msg/s
+
+	// a burst of 400 msg/s moves the smoothed rate to 0.3*400 + 0.7*100 = 190 msg/s
+	delay, err := estimator.Estimate(1900, 5000, start.Add(20*time.Second))
+	if err != nil {
+		t.Fatalf("Estimate() error = %v", err)
+	}
+	if math.Abs(delay-10) > 1e-9 {
+		t.Errorf("Expected 10 seconds delay, got %f", delay)
+	}
+}
+
+func TestTimeLagEstimatorStalledTopic(t *testing.T) {
+	start := time.Now()
+	estimator := &timeLagEstimator{}
+	_, _ = estimator.Estimate(500, 1000, start)
+
+	// nothing produced, lag not consumed: delay grows with wall time
+	delay, _ := estimator.Estimate(500, 1000, start.Add(5*time.Second))
+	if delay != 5 {
+		t.Errorf("Expected 5 seconds delay, got %f", delay)
+	}
+	delay, _ = estimator.Estimate(500, 1000, start.Add(15*time.Second))
+	if delay != 15 {
+		t.Errorf("Expected 15 seconds delay, got %f", delay)
+	}
+}
+
+func TestTimeLagEstimatorResetsOnOffsetRewind(t *testing.T) {
+	start := time.Now()
+	estimator := &timeLagEstimator{}
+	_, _ = estimator.Estimate(0, 1000, start)
+	if _, err := estimator.Estimate(0, 10, start.Add(time.Second)); !errors.Is(err, source.ErrNotReady) {
+		t.Errorf("Expected ErrNotReady after end offsets went backwards, got %v", err)
+	}
+}
+
+func TestEndOffset(t *testing.T) {
+	partitions := map[int32]kadm.GroupMemberLag{
+		0: {End: kadm.ListedOffset{Offset: 100}},
+		1: {End: kadm.ListedOffset{Offset: 50}},
+	}
+	if total, err := endOffset(partitions); err != nil || total != 150 {
+		t.Errorf("Expected 150, got %d (%v)", total, err)
+	}
+
+	// a partial sum would look like a recreated topic and reset the estimator
+	partitions[2] = kadm.GroupMemberLag{End: kadm.ListedOffset{Offset: 70, Err: errors.New("not leader")}}
+	if _, err := endOffset(partitions); err == nil {
+		t.Errorf("Expected an error when a partition end offset is missing")
+	}
+}
+
+func TestEstimateTimeLagMissingEndOffset(t *testing.T) {
+	s := &Source{estimators: make(map[string]*timeLagEstimator), options: LagOptions{Mode: LagModeTime}}
+	groupLag := kadm.GroupLag{
+		"a": {0: {End: kadm.ListedOffset{Offset: 100, Err: errors.New("not leader")}}},
+		"b": {0: {End: kadm.ListedOffset{Offset: 100}}},
+	}
+	lags := kadm.GroupTopicsLag{"a": {Lag: 10}, "b": {Lag: 10}}
+
+	_, err := s.estimateTimeLag(groupLag, lags, []string{"a", "b"}, time.Now())
+	if !errors.Is(err, source.ErrNotReady) {
+		t.Errorf("Expected the sample to be skipped as not ready, got %v", err)
+	}
+	// the topics after the one without end offsets are still sampled
+	if s.estimators["b"].prevTime.IsZero() {
+		t.Errorf("Expected topic b to be sampled")
+	}
+	if !s.estimators["a"].prevTime.IsZero() {
+		t.Errorf("Expected topic a to keep its state")
+	}
+}
@@ -12,6 +12,41 @@ var (
 		},
 		[]string{"namespaced_name", "topic", "group"},
 	)
+	KafkaLagSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_lag_seconds",
+			Help: "Estimated Kafka time lag in seconds per namespaced name, published in the time lag mode",
+		},
+		[]string{"namespaced_name", "topic", "group"},
+	)
+	SourceValue = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "source_value",
+			Help: "Value reported by the metric source per namespaced name and source type",
+		},
+		[]string{"namespaced_name", "source"},
+	)
+	KafkaPartitionLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_partition_lag",
+			Help: "Kafka lag per partition per namespaced name",
+		},
+		[]string{"namespaced_name", "topic", "partition", "group"},
+	)
+	KafkaPartitions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_partitions",
+			Help: "Number of partitions of the selected topics per namespaced name",
+		},
+		[]string{"namespaced_name", "group"},
+	)
+	KafkaGroupState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_group_state",
+			Help: "Kafka consumer group state per namespaced name, 1 for the current state",
+		},
+		[]string{"namespaced_name", "group", "state"},
+	)
 	ReferenceSignal = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "reference_signal",
@@ -1,23 +1,80 @@
 package pid
 
 import (
+	"math"
 	"sync"
 	"time"
 )
 
 const defaultDt = 1.0
 
+// AntiWindup selects how the integral is kept from winding up while the output is saturated
+type AntiWindup int
+
+const (
+	// ConditionalIntegration stops integrating while the error drives the output beyond its limits
+	ConditionalIntegration AntiWindup = iota
+	// BackCalculation integrates and feeds the excess of the output over its limits back to the integral,
+	// scaled by the tracking gain
+	BackCalculation
+	// IntegralClamp integrates and clamps the integral term to the integral limits
+	IntegralClamp
+)
+
+// State is a snapshot of the controller state, it survives restarts of the controller through Snapshot and Restore
+type State struct {
+	Integral        float64
+	PrevError       float64
+	PrevMeasurement float64
+	Derivative      float64
+	Bias            float64
+	PrevTime        time.Time
+}
+
+// Mode selects the form of the controller
+type Mode int
+
+const (
+	// Positional computes the output as the sum of the P, I and D terms
+	Positional Mode = iota
+	// Velocity computes the change of the output and adds it to the current output, see SetCurrentOutput
+	Velocity
+)
+
 // PID holds the controller parameters and state.
 type PID struct {
 	Kp, Ki, Kd float64 // Gains
 	minOutput  float64 // Minimum output (1 pod)
 	maxOutput  float64 // Maximum output (100 pods)
 
-	integral  float64 // Integral accumulator
-	prevError float64 // Previous error, for derivative
-	prevTime  time.Time
-	Reverse   bool // Reverse control direction
-	mu        sync.Mutex
+	derivativeOnMeasurement bool    // Differentiate the measured value instead of the error
+	filterTime              float64 // Time constant of the derivative low-pass filter, in seconds
+	filterN                 float64 // Derivative filter factor, the time constant is Kd/(Kp*N) when filterTime is 0
+
+	mode         Mode       // Positional or velocity form
+	pWeight      float64    // Setpoint weight of the proportional term, b
+	dWeight      float64    // Setpoint weight of the derivative term on error, c
+	rampRate     float64    // Maximum change of the setpoint per second, 0 disables the ramp
+	deadband     float64    // Errors within the deadband hold the output, 0 disables it
+	antiWindup   AntiWindup // Anti-windup strategy
+	trackingGain float64    // Back-calculation tracking gain, 1/s; 0 tracks the output limits within one update
+	integralMin  float64    // Lower limit of the integral term for IntegralClamp
+	integralMax  float64    // Upper limit of the integral term for IntegralClamp
+
+	integral        float64 // Integral accumulator
+	bias            float64 // Output offset kept from the integral term when Ki is set to 0
+	prevError       float64 // Previous error, for derivative
+	prevMeasurement float64 // Previous measured value, for derivative on measurement
+	derivative      float64 // Filtered derivative term
+	seed            float64 // Output the next update starts from, when seedPending is set
+	seedPending     bool
+	current         float64 // Output the next velocity update starts from, when currentPending is set
+	currentPending  bool
+	lastOutput      float64 // Output of the last update, when hasOutput is set
+	hasOutput       bool
+	prevTime        time.Time
+	Reverse         bool // Reverse control direction
+	mu              sync.Mutex
 }
 
 // NewPID returns a PID controller with given gains and output limits.
@@ -28,13 +85,31 @@ func NewPID(kp, ki, kd, minOut, maxOut float64, reverse bool) *PID {
 		Kd:        kd,
 		minOutput: minOut,
 		maxOutput: maxOut,
+		pWeight:   1,
+		dWeight:   1,
 		Reverse:   reverse,
 	}
 }
 
+// UpdateConfig changes gains and output limits. The integral term takes up the change of the proportional term at
+// the last error, or an output bias does when Ki is 0, so the output stays continuous when Kp or Ki change.
 func (pid *PID) UpdateConfig(kp, ki, kd, minOut, maxOut float64, reverse bool) {
 	pid.mu.Lock()
 	defer pid.mu.Unlock()
+	if kp != pid.Kp || ki != pid.Ki {
+		// the part of the output that doesn't follow the error, an integral accumulated while Ki was 0 is dropped
+		offset := pid.bias + pid.Ki*pid.integral
+		if pid.hasOutput && pid.mode == Positional {
+			offset += (pid.Kp - kp) * pid.weightedError(pid.prevSetpoint(), pid.prevMeasurement, pid.pWeight)
+		}
+		if ki != 0 {
+			pid.integral = offset / ki
+			pid.bias = 0
+		} else {
+			pid.integral = 0
+			pid.bias = offset
+		}
+	}
 	pid.Kp = kp
 	pid.Ki = ki
 	pid.Kd = kd
@@ -43,6 +118,211 @@ func (pid *PID) UpdateConfig(kp, ki, kd, minOut, maxOut float64, reverse bool) {
 	pid.Reverse = reverse
 }
 
+// Seed makes the next update start from the given output instead of an empty integral, e.g. from the current
+// replicas of the target when a worker starts, so the first output doesn't drop to the minimum
+func (pid *PID) Seed(output float64) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	pid.seed = output
+	pid.seedPending = true
+}
+
+// Snapshot returns the state of the controller
+func (pid *PID) Snapshot() State {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	return State{
+		Integral:        pid.integral,
+		PrevError:       pid.prevError,
+		PrevMeasurement: pid.prevMeasurement,
+		Derivative:      pid.derivative,
+		Bias:            pid.bias,
+		PrevTime:        pid.prevTime,
+	}
+}
+
+// Restore continues from a state returned by Snapshot, a pending seed is dropped
+func (pid *PID) Restore(state State) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	pid.integral = state.Integral
+	pid.prevError = state.PrevError
+	pid.prevMeasurement = state.PrevMeasurement
+	pid.derivative = state.Derivative
+	pid.bias = state.Bias
+	pid.prevTime = state.PrevTime
+	pid.seedPending = false
+}
+
+// SetOutputLimits changes the output limits without touching gains or state
+func (pid *PID) SetOutputLimits(minOut, maxOut float64) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	pid.minOutput = minOut
+	pid.maxOutput = maxOut
+}
+
+// SetSetpoint sets the setpoint weights of the proportional (b) and derivative (c) terms and the ramp rate of the
+// setpoint. Weights below 1 soften the response to setpoint changes, the integral always uses the full error so the
+// measured value still settles at the setpoint. A positive ramp rate moves the setpoint towards a new value by at
+// most rampRate per second.
+func (pid *PID) SetSetpoint(pWeight, dWeight, rampRate float64) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	pid.pWeight = pWeight
+	pid.dWeight = dWeight
+	pid.rampRate = rampRate
+}
+
+// weightedError returns the error with the setpoint scaled by weight
+func (pid *PID) weightedError(sp, pv, weight float64) float64 {
+	if pid.Reverse {
+		return pv - weight*sp
+	}
+	return weight*sp - pv
+}
+
+// prevSetpoint returns the setpoint of the last update, derived from the previous error and measurement
+func (pid *PID) prevSetpoint() float64 {
+	if pid.Reverse {
+		return pid.prevMeasurement - pid.prevError
+	}
+	return pid.prevError + pid.prevMeasurement
+}
+
+// SetDeadband sets the width of the error deadband. While the absolute error is within it, the output is held and
+// the integral is frozen, so small fluctuations around the setpoint don't make the output wander.
+func (pid *PID) SetDeadband(width float64) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	pid.deadband = width
+}
+
+// SetMode selects the positional or the velocity form of the controller. The velocity form keeps no integral, so a
+// switch to the positional form seeds it from the last output to keep the switch bumpless.
+func (pid *PID) SetMode(mode Mode) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	if pid.mode == Velocity && mode == Positional && pid.hasOutput {
+		pid.seed = pid.lastOutput
+		pid.seedPending = true
+	}
+	if pid.mode != mode {
+		// a current output set before the switch is stale, the velocity form continues from the last output
+		pid.currentPending = false
+	}
+	pid.mode = mode
+}
+
+// SetCurrentOutput sets the output the next velocity update starts from, e.g. the actual replicas of the target,
+// so changes made outside the controller are taken into account. When it is the rounded last output, the last
+// output is kept so that increments smaller than a replica still add up.
+func (pid *PID) SetCurrentOutput(output float64) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	pid.current = output
+	pid.currentPending = true
+}
+
+// velocityBase returns the output a velocity update starts from
+func (pid *PID) velocityBase() float64 {
+	base := pid.lastOutput
+	if pid.currentPending && (!pid.hasOutput || math.Round(pid.lastOutput) != pid.current) {
+		base = pid.current
+	}
+	pid.currentPending = false
+	return base
+}
+
+// velocityOutput adds the change of the P, I and D terms to the current output
+func (pid *PID) velocityOutput(err, deltaP, deltaD, dt float64, first bool) float64 {
+	base := pid.velocityBase()
+	// there is no previous error or derivative to take the change from on the first update
+	delta := pid.Ki * err * dt
+	if !first {
+		delta += deltaP + deltaD
+	}
+	pid.lastOutput = pid.clampOutput(base + delta)
+	pid.hasOutput = true
+	return pid.lastOutput
+}
+
+// SetAntiWindup selects the anti-windup strategy. trackingGain is used by BackCalculation, integralMin and
+// integralMax by IntegralClamp; infinite integral limits fall back to the output limits.
+func (pid *PID) SetAntiWindup(strategy AntiWindup, trackingGain, integralMin, integralMax float64) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	pid.antiWindup = strategy
+	pid.trackingGain = trackingGain
+	pid.integralMin = integralMin
+	pid.integralMax = integralMax
+}
+
+// clampOutput limits the output to the output limits
+func (pid *PID) clampOutput(output float64) float64 {
+	return math.Max(pid.minOutput, math.Min(output, pid.maxOutput))
+}
+
+// clampIntegralTerm limits the integral term to the integral limits
+func (pid *PID) clampIntegralTerm(term float64) float64 {
+	low, high := pid.integralMin, pid.integralMax
+	if math.IsInf(low, -1) {
+		low = pid.minOutput
+	}
+	if math.IsInf(high, 1) {
+		high = pid.maxOutput
+	}
+	return math.Max(low, math.Min(term, high))
+}
+
+// SetDerivative selects derivative on measurement, which avoids the kick of a setpoint change, and the first-order
+// low-pass filter of the derivative term. The filter time constant is filterTime seconds, or Kd/(Kp*filterN) when
+// filterTime is 0; the filter is disabled when both are 0.
+func (pid *PID) SetDerivative(onMeasurement bool, filterTime, filterN float64) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	pid.derivativeOnMeasurement = onMeasurement
+	pid.filterTime = filterTime
+	pid.filterN = filterN
+}
+
+// derivativeFilterTime returns the time constant of the derivative filter, 0 when it is disabled
+func (pid *PID) derivativeFilterTime() float64 {
+	if pid.filterTime > 0 {
+		return pid.filterTime
+	}
+	if pid.filterN > 0 && pid.Kp > 0 {
+		return pid.Kd / (pid.Kp * pid.filterN)
+	}
+	return 0
+}
+
+// derivativeTerm computes the filtered derivative term, first is true when there is no previous measurement
+func (pid *PID) derivativeTerm(sp, pv, prevSP, dt float64, first bool) float64 {
+	var d float64
+	switch {
+	case first:
+		// there is no previous measurement to take the derivative from
+	case pid.derivativeOnMeasurement:
+		// the setpoint is treated as constant, so the derivative of the error is the one of the measurement
+		d = pid.Kd * (pv - pid.prevMeasurement) / dt
+		if !pid.Reverse {
+			d = -d
+		}
+	default:
+		err := pid.weightedError(sp, pv, pid.dWeight)
+		prevErr := pid.weightedError(prevSP, pid.prevMeasurement, pid.dWeight)
+		d = pid.Kd * ((err - prevErr) / dt)
+	}
+
+	if tf := pid.derivativeFilterTime(); tf > 0 {
+		pid.derivative += dt / (tf + dt) * (d - pid.derivative)
+	} else {
+		pid.derivative = d
+	}
+	return pid.derivative
+}
+
 // Update computes the new controller output given setpoint (sp) and measured value (pv).
 // 'now' is the current time; pass time.Now() in real usage.
 func (pid *PID) Update(sp, pv float64, now time.Time) float64 {
@@ -50,7 +330,8 @@ func (pid *PID) Update(sp, pv float64, now time.Time) float64 {
 	defer pid.mu.Unlock()
 
 	var dt float64
-	if !pid.prevTime.IsZero() {
+	first := pid.prevTime.IsZero()
+	if !first {
 		dt = now.Sub(pid.prevTime).Seconds()
 	}
 	pid.prevTime = now
@@ -58,46 +339,99 @@ func (pid *PID) Update(sp, pv float64, now time.Time) float64 {
 		dt = defaultDt
 	}
 
+	prevSP := pid.prevSetpoint()
+	if !first && pid.rampRate > 0 {
+		// move towards a new setpoint gradually instead of in a single step
+		step := pid.rampRate * dt
+		sp = math.Max(prevSP-step, math.Min(sp, prevSP+step))
+	}
+
 	// Calculate error
 	// If Reverse is true, the controller tries to keep the measured value below the setpoint
-	var err float64
-	if pid.Reverse {
-		err = pv - sp
-	} else {
-		err = sp - pv
-	}
+	err := pid.weightedError(sp, pv, 1)
 
-	p := pid.Kp * err
+	p := pid.Kp * pid.weightedError(sp, pv, pid.pWeight)
 
 	newIntegral := pid.integral + err*dt
-	d := pid.Kd * ((err - pid.prevError) / dt)
-	unclampedOutput := p + pid.Ki*newIntegral + d
+	prevDerivative := pid.derivative
+	d := pid.derivativeTerm(sp, pv, prevSP, dt, first)
+	if pid.deadband > 0 && math.Abs(err) <= pid.deadband && pid.hasOutput && !pid.seedPending {
+		// hold the output and freeze integration, the velocity form still follows external changes
+		output := pid.lastOutput
+		if pid.mode == Velocity {
+			output = pid.velocityBase()
+		}
+		pid.lastOutput = pid.clampOutput(output)
+		pid.prevError = err
+		pid.prevMeasurement = pv
+		return pid.lastOutput
+	}
+	if pid.mode == Velocity {
+		// the output is bounded by the limits and there is no integral to wind up
+		pid.seedPending = false
+		deltaP := p - pid.Kp*pid.weightedError(prevSP, pid.prevMeasurement, pid.pWeight)
+		output := pid.velocityOutput(err, deltaP, d-prevDerivative, dt, first)
+		pid.prevError = err
+		pid.prevMeasurement = pv
+		return output
+	}
+	if pid.seedPending {
+		// bumpless start, the integral term makes up the difference between the seed and the other terms
+		pid.seedPending = false
+		if pid.Ki != 0 {
+			newIntegral = (pid.clampOutput(pid.seed) - p - d) / pid.Ki
+		}
+	}
+	unclampedOutput := pid.bias + p + pid.Ki*newIntegral + d
 
 	// Check for saturation (anti-windup)
 	var output float64
-	if unclampedOutput > pid.maxOutput {
-		output = pid.maxOutput
-		// If err is driving output beyond max, do not integrate further
-		// (conditional integration)
-		if err < 0 {
-			// If error is negative, it might help drive output back within limits
-			pid.integral = newIntegral
+	switch pid.antiWindup {
+	case BackCalculation:
+		output = pid.clampOutput(unclampedOutput)
+		pid.integral = newIntegral
+		if output != unclampedOutput && pid.Ki != 0 {
+			// move the integral term towards the value that would have kept the output at the limit
+			tracking := 1.0
+			if pid.trackingGain > 0 {
+				tracking = math.Min(pid.trackingGain*dt, 1)
+			}
+			pid.integral += tracking * (output - unclampedOutput) / pid.Ki
 		}
-		// else do not update integral, to avoid wind-up
-	} else if unclampedOutput < pid.minOutput {
-		output = pid.minOutput
-		// If err is positive, it might help drive output back within limits
-		if err > 0 {
-			pid.integral = newIntegral
+	case IntegralClamp:
+		if pid.Ki != 0 {
+			newIntegral = pid.clampIntegralTerm(pid.Ki*newIntegral) / pid.Ki
 		}
-	} else {
-		// Within limits, accept
-		output = unclampedOutput
 		pid.integral = newIntegral
+		output = pid.clampOutput(pid.bias + p + pid.Ki*newIntegral + d)
+	default:
+		if unclampedOutput > pid.maxOutput {
+			output = pid.maxOutput
+			// If err is driving output beyond max, do not integrate further
+			// (conditional integration)
+			if err < 0 {
+				// If error is negative, it might help drive output back within limits
+				pid.integral = newIntegral
+			}
+			// else do not update integral, to avoid wind-up
+		} else if unclampedOutput < pid.minOutput {
+			output = pid.minOutput
+			// If err is positive, it might help drive output back within limits
+			if err > 0 {
+				pid.integral = newIntegral
+			}
+		} else {
+			// Within limits, accept
+			output = unclampedOutput
+			pid.integral = newIntegral
+		}
 	}
 
 	// Save state
 	pid.prevError = err
+	pid.prevMeasurement = pv
+	pid.lastOutput = output
+	pid.hasOutput = true
 
 	return output
 }
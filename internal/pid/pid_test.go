@@ -1,6 +1,7 @@
 package pid
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -34,6 +35,19 @@ func TestPIDUpdateConfig(t *testing.T) {
 	}
 }
 
+func TestPIDSetOutputLimits(t *testing.T) {
+	pid := NewPID(1.0, 0.5, 0.1, 1, 100, false)
+	pid.SetOutputLimits(1, 6)
+
+	if pid.minOutput != 1 || pid.maxOutput != 6 {
+		t.Errorf("Unexpected output limits. Got: min=%f, max=%f", pid.minOutput, pid.maxOutput)
+	}
+	output := pid.Update(100, 0, time.Now())
+	if output != 6 {
+		t.Errorf("Output should be clamped to the new maxOutput. Got: %f", output)
+	}
+}
+
 func TestPIDUpdate(t *testing.T) {
 	pid := NewPID(1.0, 0.5, 0.1, 0, 100, false)
 
@@ -84,3 +98,429 @@ func TestPIDAntiWindup(t *testing.T) {
 		t.Errorf("Integral term should not grow excessively during saturation")
 	}
 }
+
+func TestPIDDerivativeOnMeasurement(t *testing.T) {
+	start := time.Now()
+	onError := NewPID(0, 0, 1, -1000, 1000, false)
+	onMeasurement := NewPID(0, 0, 1, -1000, 1000, false)
+	onMeasurement.SetDerivative(true, 0, 0)
+
+	for _, pid := range []*PID{onError, onMeasurement} {
+		pid.Update(0, 0, start)
+	}
+	// the setpoint changes while the measured value stays the same
+	if output := onError.Update(10, 0, start.Add(time.Second)); output != 10 {
+		t.Errorf("Derivative on error should kick on a setpoint change. Got: %f", output)
+	}
+	if output := onMeasurement.Update(10, 0, start.Add(time.Second)); output != 0 {
+		t.Errorf("Derivative on measurement should not kick on a setpoint change. Got: %f", output)
+	}
+
+	// the measured value rises, the error and so the derivative term decrease
+	if output := onMeasurement.Update(10, 5, start.Add(2*time.Second)); output != -5 {
+		t.Errorf("Unexpected derivative on measurement. Got: %f", output)
+	}
+}
+
+func TestPIDDerivativeFirstUpdate(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(0, 0, 1, -1000, 1000, false)
+
+	// the first error is not a change from an error of 0
+	if output := pid.Update(10, 0, start); output != 0 {
+		t.Errorf("Derivative on error should not kick on the first update. Got: %f", output)
+	}
+	if output := pid.Update(10, 5, start.Add(time.Second)); output != -5 {
+		t.Errorf("Unexpected derivative on error after the first update. Got: %f", output)
+	}
+}
+
+func TestPIDDerivativeFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		kp, kd     float64
+		filterTime float64
+		filterN    float64
+	}{
+		{name: "Time constant", kp: 0, kd: 1, filterTime: 1},
+		{name: "N factor", kp: 1, kd: 2, filterN: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			pid := NewPID(tt.kp, 0, tt.kd, -1000, 1000, true)
+			pid.SetDerivative(true, tt.filterTime, tt.filterN)
+			pid.Update(0, 0, start)
+
+			// a step of the measured value is spread over the next updates instead of a single spike
+			pid.Update(0, 10, start.Add(time.Second))
+			if pid.derivative != tt.kd*5 {
+				t.Errorf("Filtered derivative should be half of the raw one. Got: %f", pid.derivative)
+			}
+			pid.Update(0, 10, start.Add(2*time.Second))
+			if pid.derivative != tt.kd*2.5 {
+				t.Errorf("Filtered derivative should decay. Got: %f", pid.derivative)
+			}
+		})
+	}
+}
+
+// recoveryTicks drives the controller like a lagging consumer: a small lag that winds up the integral, a long
+// saturation at the max output and a drained lag afterwards. It returns the updates needed to bring the output
+// back below half of the output range once the lag is drained.
+func recoveryTicks(pid *PID) int {
+	now := time.Now()
+	tick := func(lag float64) float64 {
+		now = now.Add(time.Second)
+		return pid.Update(0, lag, now)
+	}
+	for i := 0; i < 100; i++ {
+		tick(1)
+	}
+	for i := 0; i < 100; i++ {
+		tick(20)
+	}
+	for i := 1; i <= 1000; i++ {
+		if tick(-1) < 5 {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestPIDSaturationRecovery(t *testing.T) {
+	tests := []struct {
+		name         string
+		strategy     AntiWindup
+		trackingGain float64
+		integralMin  float64
+		integralMax  float64
+		minTicks     int
+		maxTicks     int
+	}{
+		{name: "Conditional integration", strategy: ConditionalIntegration, minTicks: 20, maxTicks: 40},
+		{name: "Back-calculation", strategy: BackCalculation, minTicks: 1, maxTicks: 1},
+		{name: "Back-calculation with tracking gain", strategy: BackCalculation, trackingGain: 0.5, minTicks: 1, maxTicks: 1},
+		{name: "Integral clamp", strategy: IntegralClamp, integralMin: -2, integralMax: 2, minTicks: 1, maxTicks: 1},
+		{
+			name: "Integral clamp to the output limits", strategy: IntegralClamp,
+			integralMin: math.Inf(-1), integralMax: math.Inf(1), minTicks: 20, maxTicks: 60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pid := NewPID(1, 0.1, 0, 0, 10, true)
+			pid.SetAntiWindup(tt.strategy, tt.trackingGain, tt.integralMin, tt.integralMax)
+			ticks := recoveryTicks(pid)
+			if ticks < tt.minTicks || ticks > tt.maxTicks {
+				t.Errorf("Expected recovery within %d to %d updates. Got: %d", tt.minTicks, tt.maxTicks, ticks)
+			}
+		})
+	}
+}
+
+func TestPIDBackCalculationTracking(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(1, 0.5, 0, 0, 10, true)
+	pid.SetAntiWindup(BackCalculation, 0.25, 0, 0)
+	pid.Update(0, 0, start)
+
+	// unclamped output is 20 + 0.5*20 = 30, a quarter of the excess of 20 is fed back
+	output := pid.Update(0, 20, start.Add(time.Second))
+	if output != 10 {
+		t.Errorf("Output should be clamped to maxOutput. Got: %f", output)
+	}
+	if term := pid.Ki * pid.integral; term != 5 {
+		t.Errorf("Integral term should be unwound by the tracking gain. Got: %f", term)
+	}
+}
+
+func TestPIDIntegralClamp(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(0, 1, 0, 0, 100, true)
+	pid.SetAntiWindup(IntegralClamp, 0, -1, 3)
+	for i := 0; i < 10; i++ {
+		pid.Update(0, 1, start.Add(time.Duration(i)*time.Second))
+	}
+	if term := pid.Ki * pid.integral; term != 3 {
+		t.Errorf("Integral term should be clamped to the integral max. Got: %f", term)
+	}
+}
+
+func TestPIDSeed(t *testing.T) {
+	pid := NewPID(1.0, 0.5, 0.1, 1, 20, true)
+	pid.Seed(8)
+
+	// the lag is below the setpoint, an unseeded controller would drop to the minimum
+	output := pid.Update(100, 90, time.Now())
+	if output != 8 {
+		t.Errorf("First output should start from the seed. Got: %f", output)
+	}
+	output = pid.Update(100, 90, time.Now().Add(time.Second))
+	if output >= 8 || output <= 1 {
+		t.Errorf("Output should move on from the seed. Got: %f", output)
+	}
+}
+
+func TestPIDSeedOutsideLimits(t *testing.T) {
+	pid := NewPID(1.0, 0.5, 0, 1, 5, true)
+	pid.Seed(8)
+	if output := pid.Update(100, 100, time.Now()); output != 5 {
+		t.Errorf("Seed should be clamped to the output limits. Got: %f", output)
+	}
+	if term := pid.Ki * pid.integral; term != 5 {
+		t.Errorf("Integral term should be seeded within the output limits. Got: %f", term)
+	}
+}
+
+func TestPIDUpdateConfigBumpless(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(0, 1, 0, 0, 100, true)
+	before := pid.Update(0, 5, start)
+
+	pid.UpdateConfig(0, 2, 0, 0, 100, true)
+	after := pid.Update(0, 0, start.Add(time.Second))
+	if after != before {
+		t.Errorf("Output should not jump when Ki changes. Got: %f, expected %f", after, before)
+	}
+
+	pid.UpdateConfig(0, 0, 0, 0, 100, true)
+	pid.Update(0, 3, start.Add(2*time.Second))
+	pid.UpdateConfig(0, 1, 0, 0, 100, true)
+	if pid.integral != before {
+		t.Errorf("Integral should continue from the output bias, not from what accumulated while Ki was 0. Got: %f",
+			pid.integral)
+	}
+}
+
+func TestPIDUpdateConfigKiToZero(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(1, 1, 0, 0, 100, true)
+	pid.Update(0, 5, start)
+	before := pid.Update(0, 5, start.Add(time.Second))
+
+	// the integral term is kept as an output bias instead of dropping out of the output
+	pid.UpdateConfig(1, 0, 0, 0, 100, true)
+	after := pid.Update(0, 5, start.Add(2*time.Second))
+	if after != before {
+		t.Errorf("Output should not jump when Ki is set to 0. Got: %f, expected %f", after, before)
+	}
+}
+
+func TestPIDUpdateConfigKp(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(1, 0.5, 0, 0, 100, true)
+	pid.Update(0, 5, start)
+	before := pid.Update(0, 5, start.Add(time.Second))
+
+	// the integral term takes up the change of the proportional term, the output only moves by the integration
+	pid.UpdateConfig(2, 0.5, 0, 0, 100, true)
+	after := pid.Update(0, 5, start.Add(2*time.Second))
+	if math.Abs(after-(before+2.5)) > 1e-9 {
+		t.Errorf("Output should not jump when Kp changes. Got: %f, expected %f", after, before+2.5)
+	}
+
+	pid = NewPID(1, 0, 0, 0, 100, true)
+	before = pid.Update(0, 5, start)
+	pid.UpdateConfig(2, 0, 0, 0, 100, true)
+	if after := pid.Update(0, 5, start.Add(time.Second)); after != before {
+		t.Errorf("Output of a P controller should not jump when Kp changes. Got: %f, expected %f", after, before)
+	}
+}
+
+func TestPIDSnapshotRestore(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(1.0, 0.5, 0.1, 0, 100, true)
+	pid.SetDerivative(true, 2, 0)
+	pid.Update(100, 120, start)
+	pid.Update(100, 130, start.Add(time.Second))
+
+	restored := NewPID(1.0, 0.5, 0.1, 0, 100, true)
+	restored.SetDerivative(true, 2, 0)
+	restored.Seed(50)
+	restored.Restore(pid.Snapshot())
+
+	next := start.Add(2 * time.Second)
+	if expected, output := pid.Update(100, 125, next), restored.Update(100, 125, next); output != expected {
+		t.Errorf("Restored controller should continue like the original one. Got: %f, expected %f", output, expected)
+	}
+}
+
+func TestPIDVelocityFollowsCurrentOutput(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(1, 0.1, 0, 1, 20, true)
+	pid.SetMode(Velocity)
+
+	pid.SetCurrentOutput(5)
+	if output := pid.Update(100, 110, start); output != 6 {
+		t.Errorf("First velocity output should add the integral step to the current output. Got: %f", output)
+	}
+
+	// the target was scaled by hand, the controller continues from there
+	pid.SetCurrentOutput(12)
+	if output := pid.Update(100, 110, start.Add(time.Second)); output != 13 {
+		t.Errorf("Velocity output should start from the external change. Got: %f", output)
+	}
+}
+
+func TestPIDVelocityKeepsFractions(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(0, 0.1, 0, 1, 20, true)
+	pid.SetMode(Velocity)
+
+	var output float64
+	replicas := 5.0
+	for i := 0; i < 10; i++ {
+		pid.SetCurrentOutput(replicas)
+		output = pid.Update(100, 101, start.Add(time.Duration(i)*time.Second))
+		replicas = math.Round(output)
+	}
+	// ten increments of 0.1 replica add up to one although every single one rounds away
+	if math.Abs(output-6) > 1e-9 {
+		t.Errorf("Small increments should add up. Got: %f", output)
+	}
+}
+
+func TestPIDVelocitySaturationRecovery(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(1, 0.5, 0, 1, 10, true)
+	pid.SetMode(Velocity)
+	pid.SetCurrentOutput(5)
+
+	var output float64
+	for i := 0; i < 100; i++ {
+		output = pid.Update(0, 20, start.Add(time.Duration(i)*time.Second))
+	}
+	if output != 10 {
+		t.Errorf("Output should be clamped to maxOutput. Got: %f", output)
+	}
+	// the lag is drained, the output leaves the limit on the first update
+	output = pid.Update(0, -1, start.Add(100*time.Second))
+	if output >= 10 {
+		t.Errorf("Velocity output should not wind up at the limit. Got: %f", output)
+	}
+}
+
+func TestPIDVelocityToPositional(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(0.1, 0.05, 0, 1, 20, true)
+	pid.SetMode(Velocity)
+	pid.SetCurrentOutput(8)
+
+	var output float64
+	for i := 0; i < 5; i++ {
+		output = pid.Update(100, 102, start.Add(time.Duration(i)*time.Second))
+	}
+
+	// the positional form continues from the velocity output instead of an empty integral
+	pid.SetMode(Positional)
+	if switched := pid.Update(100, 102, start.Add(5*time.Second)); math.Abs(switched-output) > 1e-9 {
+		t.Errorf("Output should stay where it was after the switch. Got: %f, expected %f", switched, output)
+	}
+}
+
+func TestPIDPositionalToVelocity(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(0.1, 0.05, 0, 1, 20, true)
+	pid.Seed(4)
+	pid.Update(100, 102, start)
+	// the target is scaled while the positional form runs
+	pid.SetCurrentOutput(8)
+
+	var output float64
+	for i := 1; i < 5; i++ {
+		output = pid.Update(100, 102, start.Add(time.Duration(i)*time.Second))
+	}
+
+	// the velocity form continues from the last output, not from the current output set before the switch
+	pid.SetMode(Velocity)
+	switched := pid.Update(100, 102, start.Add(5*time.Second))
+	if math.Abs(switched-output) > 0.5 {
+		t.Errorf("Output should continue from the last output after the switch. Got: %f, expected about %f", switched, output)
+	}
+}
+
+func TestPIDSetpointWeights(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(1, 0, 1, -1000, 1000, true)
+	pid.SetSetpoint(0.5, 0, 0)
+	pid.Update(100, 100, start)
+
+	// the reference drops by 50 while the measured value stays, only half of the step reaches P and none reaches D
+	output := pid.Update(50, 100, start.Add(time.Second))
+	if output != 75 {
+		t.Errorf("Unexpected output with setpoint weights. Got: %f", output)
+	}
+
+	// with the setpoint held, changes of the measured value are seen in full
+	output = pid.Update(50, 110, start.Add(2*time.Second))
+	if output != 95 {
+		t.Errorf("Unexpected output after a measurement change. Got: %f", output)
+	}
+}
+
+func TestPIDSetpointWeightsIntegral(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(1, 0.5, 0, -1000, 1000, true)
+	pid.SetSetpoint(0, 0, 0)
+	pid.Update(50, 100, start)
+	if pid.integral != 50 {
+		t.Errorf("Integral should use the full error. Got: %f", pid.integral)
+	}
+}
+
+func TestPIDSetpointRamp(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(1, 0, 0, -100000, 100000, true)
+	pid.SetSetpoint(1, 1, 100)
+	pid.Update(10000, 10000, start)
+
+	for i, expected := range []float64{9900, 9800, 9700} {
+		pid.Update(1000, 10000, start.Add(time.Duration(i+1)*time.Second))
+		if sp := pid.prevSetpoint(); math.Abs(sp-expected) > 1e-9 {
+			t.Errorf("Setpoint should ramp by 100 per second. Got: %f, expected %f", sp, expected)
+		}
+	}
+
+	// the ramp covers longer intervals in proportion and stops at the new setpoint
+	output := pid.Update(1000, 10000, start.Add(time.Hour))
+	if output != 9000 {
+		t.Errorf("Setpoint should settle at the new value. Got: %f", output)
+	}
+}
+
+func TestPIDDeadband(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(0.1, 0.05, 0, 1, 20, true)
+	pid.SetDeadband(5)
+	held := pid.Update(100, 150, start)
+	integral := pid.integral
+
+	for i, lag := range []float64{104, 96, 105, 95} {
+		if output := pid.Update(100, lag, start.Add(time.Duration(i+1)*time.Second)); output != held {
+			t.Errorf("Output should be held within the deadband. Got: %f, expected %f", output, held)
+		}
+	}
+	if pid.integral != integral {
+		t.Errorf("Integral should be frozen within the deadband. Got: %f, expected %f", pid.integral, integral)
+	}
+
+	if output := pid.Update(100, 120, start.Add(5*time.Second)); output == held {
+		t.Errorf("Output should change outside of the deadband. Got: %f", output)
+	}
+}
+
+func TestPIDDeadbandVelocity(t *testing.T) {
+	start := time.Now()
+	pid := NewPID(0.1, 0.05, 0, 1, 20, true)
+	pid.SetMode(Velocity)
+	pid.SetDeadband(5)
+	pid.SetCurrentOutput(4)
+	pid.Update(100, 150, start)
+
+	// the target was scaled by hand while the error is within the deadband
+	pid.SetCurrentOutput(10)
+	if output := pid.Update(100, 102, start.Add(time.Second)); output != 10 {
+		t.Errorf("Velocity output should hold the current output within the deadband. Got: %f", output)
+	}
+}
@@ -0,0 +1,85 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+const defaultQueryTimeout = 10 * time.Second
+
+var ErrNoSeries = errors.New("query returned no series")
+var ErrMultipleSeries = errors.New("query returned more than one series")
+var ErrNotANumber = errors.New("query returned NaN")
+
+// Source is a metric source evaluating an instant PromQL query
+type Source struct {
+	api     promv1.API
+	address string
+	query   string
+	timeout time.Duration
+}
+
+func NewSource(address string, query string, timeout time.Duration) (*Source, error) {
+	if address == "" {
+		return nil, errors.New("prometheus address is empty")
+	}
+	if query == "" {
+		return nil, errors.New("prometheus query is empty")
+	}
+	client, err := api.NewClient(api.Config{Address: address})
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+	return &Source{
+		api:     promv1.NewAPI(client),
+		address: address,
+		query:   query,
+		timeout: timeout,
+	}, nil
+}
+
+func (s *Source) Fetch(ctx context.Context) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	result, _, err := s.api.Query(ctx, s.query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var value float64
+	switch v := result.(type) {
+	case *model.Scalar:
+		value = float64(v.Value)
+	case model.Vector:
+		if len(v) == 0 {
+			return 0, ErrNoSeries
+		}
+		if len(v) > 1 {
+			return 0, fmt.Errorf("%w: got %d series", ErrMultipleSeries, len(v))
+		}
+		value = float64(v[0].Value)
+	default:
+		return 0, fmt.Errorf("unsupported query result type %s", result.Type())
+	}
+	if math.IsNaN(value) {
+		return 0, ErrNotANumber
+	}
+	return value, nil
+}
+
+func (s *Source) Close() {}
+
+func (s *Source) Describe() string {
+	return fmt.Sprintf("prometheus(query=%s)", s.query)
+}
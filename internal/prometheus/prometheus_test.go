@@ -0,0 +1,116 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newPrometheusStub(t *testing.T, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse query: %v", err)
+		}
+		if r.Form.Get("query") == "" {
+			t.Errorf("Query parameter is missing")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSourceFetch(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expected    float64
+		expectedErr error
+	}{
+		{
+			name:     "Single series",
+			body:     `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"queue":"orders"},"value":[1700000000,"1234.5"]}]}}`,
+			expected: 1234.5,
+		},
+		{
+			name:     "Scalar",
+			body:     `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"42"]}}`,
+			expected: 42,
+		},
+		{
+			name:        "No series",
+			body:        `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			expectedErr: ErrNoSeries,
+		},
+		{
+			name: "Multiple series",
+			body: `{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"queue":"a"},"value":[1700000000,"1"]},` +
+				`{"metric":{"queue":"b"},"value":[1700000000,"2"]}]}}`,
+			expectedErr: ErrMultipleSeries,
+		},
+		{
+			name:        "NaN",
+			body:        `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"NaN"]}}`,
+			expectedErr: ErrNotANumber,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newPrometheusStub(t, tt.body)
+			source, err := NewSource(server.URL, "sum(queue_backlog)", time.Second)
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			defer source.Close()
+
+			value, err := source.Fetch(context.Background())
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("Fetch() error = %v, expected %v", err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+			if value != tt.expected {
+				t.Errorf("Fetch() = %f, expected %f", value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSourceFetchQueryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+	}))
+	defer server.Close()
+
+	source, err := NewSource(server.URL, "sum(", time.Second)
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	if _, err = source.Fetch(context.Background()); err == nil {
+		t.Errorf("Expected error for invalid query")
+	}
+}
+
+func TestNewSourceValidation(t *testing.T) {
+	if _, err := NewSource("", "up", 0); err == nil {
+		t.Errorf("Expected error for empty address")
+	}
+	if _, err := NewSource("http://localhost:9090", "", 0); err == nil {
+		t.Errorf("Expected error for empty query")
+	}
+}
@@ -0,0 +1,40 @@
+package source
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotReady is returned by Fetch while a source is still collecting the samples it needs to report a value
+var ErrNotReady = errors.New("metric source has no value yet")
+
+// MetricSource provides the process variable for the PID regulator
+type MetricSource interface {
+	// Fetch returns the current value of the controlled variable
+	Fetch(ctx context.Context) (float64, error)
+	// Close releases any connections held by the source
+	Close()
+	// Describe returns a short human-readable description, used in logs and metric labels
+	Describe() string
+}
+
+// PartitionLag is the lag of a single partition
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	Lag       int64
+}
+
+// PartitionedSource is implemented by sources whose consumers can't make use of more replicas than there are partitions
+type PartitionedSource interface {
+	// Partitions returns the partition count observed by the last successful Fetch
+	Partitions() int32
+	// PartitionLags returns the per-partition lag observed by the last successful Fetch
+	PartitionLags() []PartitionLag
+}
+
+// StateReporter is implemented by sources observing a consumer with a lifecycle state, e.g. a Kafka consumer group
+type StateReporter interface {
+	// State returns the consumer state observed by the last Fetch, empty if unknown
+	State() string
+}
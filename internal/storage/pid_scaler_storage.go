@@ -7,11 +7,20 @@ import (
 	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
 )
 
+// KafkaTLSMaterial holds PEM data resolved from the Secrets referenced by KafkaSettings.TLS
+type KafkaTLSMaterial struct {
+	CA   []byte
+	Cert []byte
+	Key  []byte
+}
+
 // PIDScalerState is a struct that holds the parameters for the PID controller
 type PIDScalerState struct {
 	TargetSettings  pidscalerv1.TargetSettings
 	PidSettings     pidscalerv1.PIDSettings
+	SourceSettings  pidscalerv1.SourceSettings
 	KafkaSettings   pidscalerv1.KafkaSettings
+	KafkaTLS        KafkaTLSMaterial
 	CooldownTimeout int32
 	Interval        int32
 	ControlCh       chan int
@@ -23,38 +32,59 @@ const (
 	KafkaSettingsMask
 	IntervalMask
 	CooldownTimeoutMask
+	SourceSettingsMask
 )
 
 func NewPIDScalerState(pidScaler *pidscalerv1.PIDScaler) *PIDScalerState {
+	// apply the defaults of the webhook, which may be disabled
+	pidScaler = pidScaler.DeepCopy()
+	pidScaler.SetDefaults()
 	scaler := &PIDScalerState{
 		TargetSettings: pidscalerv1.TargetSettings{
-			Deployment:  pidScaler.Spec.Target.Deployment,
-			Namespace:   pidScaler.Spec.Target.Namespace,
-			MinReplicas: pidScaler.Spec.Target.MinReplicas,
-			MaxReplicas: pidScaler.Spec.Target.MaxReplicas,
-		},
-		PidSettings: pidscalerv1.PIDSettings{
-			Kp:              pidScaler.Spec.PID.Kp,
-			Ki:              pidScaler.Spec.PID.Ki,
-			Kd:              pidScaler.Spec.PID.Kd,
-			ReferenceSignal: pidScaler.Spec.PID.ReferenceSignal,
+			Deployment:     pidScaler.Spec.Target.Deployment,
+			ScaleTargetRef: pidScaler.Spec.Target.ScaleTargetRef.DeepCopy(),
+			Namespace:      pidScaler.Spec.Target.Namespace,
+			MinReplicas:    pidScaler.Spec.Target.MinReplicas,
+			MaxReplicas:    pidScaler.Spec.Target.MaxReplicas,
+			Behavior:       pidScaler.Spec.Target.Behavior.DeepCopy(),
 		},
-		KafkaSettings: pidscalerv1.KafkaSettings{
-			Topic:   pidScaler.Spec.Kafka.Topic,
-			Group:   pidScaler.Spec.Kafka.Group,
-			Brokers: pidScaler.Spec.Kafka.Brokers,
+		PidSettings: pidScaler.Spec.PID,
+		SourceSettings: pidscalerv1.SourceSettings{
+			Type:       pidScaler.Spec.Source.GetType(),
+			Prometheus: pidScaler.Spec.Source.Prometheus.DeepCopy(),
 		},
 		CooldownTimeout: pidScaler.Spec.CooldownTimeout,
 		Interval:        pidScaler.Spec.Interval,
 		ControlCh:       make(chan int),
 	}
+	if pidScaler.Spec.Kafka != nil {
+		scaler.KafkaSettings = pidscalerv1.KafkaSettings{
+			Topic:                pidScaler.Spec.Kafka.Topic,
+			Topics:               pidScaler.Spec.Kafka.Topics,
+			TopicPattern:         pidScaler.Spec.Kafka.TopicPattern,
+			Aggregation:          pidScaler.Spec.Kafka.Aggregation,
+			LagMode:              pidScaler.Spec.Kafka.LagMode,
+			Group:                pidScaler.Spec.Kafka.Group,
+			Brokers:              pidScaler.Spec.Kafka.Brokers,
+			UseSASL:              pidScaler.Spec.Kafka.UseSASL,
+			SASLMechanism:        pidScaler.Spec.Kafka.SASLMechanism,
+			Username:             pidScaler.Spec.Kafka.Username,
+			Password:             pidScaler.Spec.Kafka.Password,
+			CredentialsSecretRef: pidScaler.Spec.Kafka.CredentialsSecretRef.DeepCopy(),
+			TLS:                  pidScaler.Spec.Kafka.TLS.DeepCopy(),
+			OAuth:                pidScaler.Spec.Kafka.OAuth.DeepCopy(),
+			CapToPartitions:      pidScaler.Spec.Kafka.CapToPartitions,
+			PartitionLagMetrics:  pidScaler.Spec.Kafka.PartitionLagMetrics,
+			GroupStatePolicy:     pidScaler.Spec.Kafka.GroupStatePolicy.DeepCopy(),
+		}
+	}
 	return scaler
 }
 
 // GetDifferenceMask compare to PIDScalerState and calculate mask of changes
 func (d *PIDScalerState) GetDifferenceMask(s *PIDScalerState) int {
 	mask := 0
-	if d.TargetSettings != s.TargetSettings {
+	if !cmp.Equal(d.TargetSettings, s.TargetSettings) {
 		d.TargetSettings = s.TargetSettings
 		mask |= TargetSettingsMask
 	}
@@ -64,11 +94,17 @@ func (d *PIDScalerState) GetDifferenceMask(s *PIDScalerState) int {
 		mask |= PidSettingsMask
 	}
 
-	if !cmp.Equal(d.KafkaSettings, s.KafkaSettings) {
+	if !cmp.Equal(d.KafkaSettings, s.KafkaSettings) || !cmp.Equal(d.KafkaTLS, s.KafkaTLS) {
 		d.KafkaSettings = s.KafkaSettings
+		d.KafkaTLS = s.KafkaTLS
 		mask |= KafkaSettingsMask
 	}
 
+	if !cmp.Equal(d.SourceSettings, s.SourceSettings) {
+		d.SourceSettings = s.SourceSettings
+		mask |= SourceSettingsMask
+	}
+
 	if d.Interval != s.Interval {
 		d.Interval = s.Interval
 		mask |= IntervalMask
@@ -5,6 +5,8 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	pidscalerv1 "github.com/timson/pidhpa-operator/api/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/utils/ptr"
 )
 
 func TestScalerUpdateFrom(t *testing.T) {
@@ -70,6 +72,23 @@ func TestScalerUpdateFrom(t *testing.T) {
 			},
 			expected: TargetSettingsMask,
 		},
+		{
+			name: "Change behavior",
+			initial: PIDScalerState{
+				TargetSettings: pidscalerv1.TargetSettings{Deployment: "app", MinReplicas: 1, MaxReplicas: 5},
+			},
+			updated: PIDScalerState{
+				TargetSettings: pidscalerv1.TargetSettings{
+					Deployment:  "app",
+					MinReplicas: 1,
+					MaxReplicas: 5,
+					Behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+						ScaleDown: &autoscalingv2.HPAScalingRules{StabilizationWindowSeconds: ptr.To(int32(60))},
+					},
+				},
+			},
+			expected: TargetSettingsMask,
+		},
 		{
 			name: "Change PIDSettings",
 			initial: PIDScalerState{
@@ -98,6 +117,29 @@ func TestScalerUpdateFrom(t *testing.T) {
 			},
 			expected: KafkaSettingsMask,
 		},
+		{
+			name: "Change SourceSettings",
+			initial: PIDScalerState{
+				SourceSettings: pidscalerv1.SourceSettings{Type: pidscalerv1.SourceTypeKafka},
+			},
+			updated: PIDScalerState{
+				SourceSettings: pidscalerv1.SourceSettings{
+					Type:       pidscalerv1.SourceTypePrometheus,
+					Prometheus: &pidscalerv1.PrometheusSettings{Address: "http://prometheus:9090", Query: "sum(backlog)"},
+				},
+			},
+			expected: SourceSettingsMask,
+		},
+		{
+			name: "Rotate Kafka TLS certificate",
+			initial: PIDScalerState{
+				KafkaTLS: KafkaTLSMaterial{CA: []byte("ca-1")},
+			},
+			updated: PIDScalerState{
+				KafkaTLS: KafkaTLSMaterial{CA: []byte("ca-2")},
+			},
+			expected: KafkaSettingsMask,
+		},
 		{
 			name: "Change Interval",
 			initial: PIDScalerState{
@@ -157,6 +199,10 @@ func TestScalerUpdateFrom(t *testing.T) {
 				t.Errorf("KafkaSettings not updated correctly")
 			}
 
+			if tt.expected&SourceSettingsMask != 0 && !cmp.Equal(tt.initial.SourceSettings, tt.updated.SourceSettings) {
+				t.Errorf("SourceSettings not updated correctly")
+			}
+
 			if tt.expected&IntervalMask != 0 && tt.initial.Interval != tt.updated.Interval {
 				t.Errorf("Interval not updated correctly")
 			}